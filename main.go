@@ -15,348 +15,318 @@
 //
 // Required Environment Variables:
 // - STRAVA_CLIENT_ID: Strava OAuth client ID
-// - STRAVA_CLUB_ID: Strava club ID to fetch events from
+// - STRAVA_CLUB_ID: Strava club ID to fetch events from, or several comma-separated
 // - CLIENT_SECRET: Strava OAuth client secret
 // - REFRESH_TOKEN: Strava OAuth refresh token
 // - GOOGLE_CALENDAR_ID: Target Google Calendar ID
 // - GOOGLE_SERVICE_ACCOUNT: Google service account JSON (base64 encoded or JSON string)
 //
+// Optional Environment Variables:
+// - CLIENT_SECRET_FILE, REFRESH_TOKEN_FILE, GOOGLE_SERVICE_ACCOUNT_FILE: Read the secret from a file instead, e.g. a Docker secret
+// - GOOGLE_PUBLIC_CALENDAR_ID: Second calendar synced with leader names and contact details removed
+// - GOOGLE_AUTH_MODE: "service_account" (default) or "oauth" to use your own Google account
+// - GOOGLE_OAUTH_CLIENT_ID, GOOGLE_OAUTH_CLIENT_SECRET, GOOGLE_OAUTH_REFRESH_TOKEN: OAuth user credentials
+// - STORE: Event cache backend, "json" (default) or "sqlite" (needs a build with -tags sqlite)
+// - OUTPUT_DIR: Directory for generated files and caches (default output)
+// - SYNC_WINDOW_DAYS: Number of days ahead to sync (default 60)
+// - FILTER_SINCE_DAYS: Number of days of past events to keep (default 7, 0 for future events only)
+// - FETCH_CONCURRENCY: Number of clubs fetched from Strava at once (default 2)
+// - HTTP_TIMEOUT: Timeout for each Strava and Google Calendar request, e.g. "45s" (default 30s)
+// - RUN_TIMEOUT: Deadline for a whole run, or each sync in server mode, e.g. "10m" (default 15m, 0 for none)
+// - MAX_EVENTS: Abort the sync if Strava returns more events than this (default 1000, 0 for no limit)
+// - DELETE_GRACE_RUNS: Consecutive runs an event must be missing from Strava before it is deleted (default 1)
+// - DEFAULT_TIMEZONE: Timezone for events without one from Strava (default Europe/London)
+// - DEFAULT_EVENT_DURATION_MINUTES: Estimated event length (default 60)
+// - EVENT_DURATION_OVERRIDES: Per-activity estimated lengths, e.g. "Run=90,Ride=180"
+// - DURATION_MODE: "fixed" (default) or "estimate-from-distance" to estimate lengths from route distance
+// - ACTIVITY_PACES: Per-activity average paces in minutes per km, e.g. "Run=6,Ride=2.5"
+// - END_TIME: "estimated" (default) or "none" to publish events without an end time
+// - GEOCODER: "nominatim" or "google" to name meeting points that only have coordinates
+// - GEOCODER_URL, GOOGLE_GEOCODING_API_KEY: Geocoding endpoint override and Google API key
+// - INCLUDE_WOMEN_ONLY: Set to false to leave out women-only events
+// - PRIVATE_EVENTS: "include" (default), "exclude" or "only" private events
+// - EXCLUDE_EVENT_IDS: Comma-separated Strava event IDs to leave out
+// - EXCLUDE_TITLE_REGEX: Leave out events whose title matches this regular expression
+// - UNITS: "metric" (default) or "imperial" for route distances
+// - PHONE_REGION: Phone number formats to redact, any of "UK" (default), "US" and "INTL"
+// - ALL_DAY_MIDNIGHT_EVENTS: Set to false to keep events starting at midnight as timed events
+// - EVENT_VISIBILITY: "strava" (default, private for Strava's private events), "public", "private" or "default"
+// - TENTATIVE_TITLE_REGEX: Titles of provisional events, shown as tentative (default: starting "[TBC]")
+// - TITLE_TAG_REGEX: Tags in event titles, e.g. "\[([^\]]+)\]" for "[Social]", added as ICS categories and to descriptions
+// - ACTIVITY_PREFIX_MAP: Per-activity title prefixes, e.g. "Run=🏃,Ride=🚴"
+// - ICS_PREVIEW: Set to true to publish provisional events only in calendar-preview.ics
+// - ICS_SPLIT_BY: "activity", "terrain" or "skill" to also write one ICS file per value to calendars/
+// - MERGE_CLUB_DUPLICATES: Set to true to merge runs posted to several clubs into one event
+// - ADOPT_MANUAL_EVENTS: Set to true to adopt matching manually created Google Calendar events
+// - TERRAIN_COLORS: Google Calendar color IDs by terrain, e.g. "0=9,1=10,2=5"
+// - EVENT_REMINDERS: Google Calendar reminders, e.g. "popup=60,email=1440" (minutes before)
+// - DESCRIPTION_TEMPLATE, DESCRIPTION_TEMPLATE_FILE: Go template for event descriptions, inline or from a file
+// - GOOGLE_DESCRIPTION_FORMAT: "text" (default) or "html" to keep Strava's lists and emphasis in Google Calendar
+// - CALDAV_URL, CALDAV_USERNAME, CALDAV_PASSWORD: CalDAV calendar collection to sync events to as well
+// - ICS_CALENDAR_NAME, ICS_CALENDAR_DESC, ICS_PRODID: Calendar title, description and producer ID
+// - ICS_REMINDERS: ICS alarms as ISO 8601 durations before the start, e.g. "P1D,PT1H"
+// - ICS_DAY_SUMMARY: "off" (default), "add" or "only" for an all-day overview of each day's events in the ICS file
+// - STABLE_TIMESTAMPS: Set to true to leave the generation time out of the ICS file, for stable diffs
+// - AUTHORIZE_PORT: Local callback port for the authorize command (default 8765)
+// - SLACK_WEBHOOK_URL, NOTIFY_WEBHOOK_URL: Slack or other (e.g. Discord) webhooks told about calendar changes
+// - HEARTBEAT_URL: Healthcheck URL pinged on success (and at /fail on failure)
+// - SYNC_SECRET: Shared secret for POST /sync in server mode (required by the serve command)
+// - SERVE_PORT: Port for the serve command (default 8080)
+// - SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD: Mail server for the digest command (port default 587)
+// - SMTP_FROM, SMTP_TO: Sender and comma-separated recipients of the digest command
+// - ARCHIVE_CALENDAR_ID: Google Calendar that the backfill command copies past events into
+// - LOG_FORMAT: "text" (default) or "json"
+// - LOG_LEVEL: DEBUG, INFO (default), WARN or ERROR
+// - CONFIG_FILE: JSON file setting any of these variables (also --config), overridden by the environment
+//
 // Authentication:
 // - Strava: OAuth2 with refresh token
-// - Google Calendar: Service account (service-account.json)
+// - Google Calendar: Service account (service-account.json) or OAuth user credentials
+//
+// The sync itself is in the stravacal package; this command reads its
+// configuration from the environment, a config file and flags
 //
 // Successfully validated October 2025 with real events
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
 	"os"
-	"sort"
-	"time"
+	"slices"
+	"strings"
+
+	"github.com/bkach/StravaCal/stravacal"
 )
 
+// Exit codes let cron wrappers tell a broken setup from a flaky API
 const (
-	eventsFile   = "output/events/events.json"
-	calendarFile = "output/calendar.ics"
+	exitFailure          = 1  // Configuration, authentication or other hard errors
+	exitTemporaryFailure = 75 // EX_TEMPFAIL: Strava API temporarily unavailable, retry later
 )
 
 func main() {
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "test":
-			testWithSampleData()
-			return
-		case "ics":
-			generateICSOnly()
-			return
-		case "gcal":
-			syncGoogleCalendarOnly()
-			return
-		}
+	cfg, args, err := loadConfig(os.Args[1:])
+	if err == nil {
+		err = stravacal.Run(context.Background(), cfg, args)
 	}
-
-	// Default: Full sync - fetch from Strava, sync to Google Calendar, generate ICS
-	log.Println("Starting Strava to Google Calendar Sync...")
-
-	// Load Strava tokens
-	tokens, err := loadTokens()
 	if err != nil {
-		log.Fatalf("Failed to load tokens: %v", err)
-	}
-
-	// Fetch events from Strava
-	log.Println("Fetching club events from Strava API...")
-	stravaEvents, err := fetchClubEvents(tokens)
-	if err != nil {
-		log.Printf("Failed to fetch events from API: %v", err)
-		log.Println("API might be temporarily unavailable.")
-		return
-	}
-
-	log.Printf("Fetched %d events from Strava", len(stravaEvents))
-
-	// Convert Strava events to our format
-	var convertedEvents []Event
-	for _, se := range stravaEvents {
-		event, err := convertStravaEvent(se)
-		if err != nil {
-			log.Printf("Failed to convert event %d: %v", se.ID, err)
-			continue
-		}
-		convertedEvents = append(convertedEvents, *event)
-	}
-
-	// Filter and sort events
-	log.Println("Filtering and sorting events...")
-	finalEvents := filterAndSortEvents(convertedEvents)
-
-	// Save events to JSON for backup
-	log.Printf("Saving %d events to %s...", len(finalEvents), eventsFile)
-	if err := saveEvents(finalEvents); err != nil {
-		log.Fatalf("Failed to save events: %v", err)
-	}
-
-	// Get Google Calendar ID from environment
-	calendarID := os.Getenv("GOOGLE_CALENDAR_ID")
-	if calendarID == "" {
-		log.Println("Warning: GOOGLE_CALENDAR_ID not set, skipping Google Calendar sync")
-	} else {
-		// Authenticate with Google Calendar
-		log.Println("Authenticating with Google Calendar...")
-		calendarService, err := getCalendarService()
-		if err != nil {
-			log.Fatalf("Failed to authenticate with Google Calendar: %v", err)
-		}
-
-		// Sync all events with Google Calendar (no date filtering)
-		log.Printf("Syncing %d events with Google Calendar...", len(finalEvents))
-		if err := syncStravaEvents(finalEvents, calendarService, calendarID); err != nil {
-			log.Fatalf("Failed to sync events with Google Calendar: %v", err)
+		var tempErr *stravacal.TemporaryError
+		if errors.As(err, &tempErr) {
+			slog.Error("Temporary failure", "error", err)
+			os.Exit(exitTemporaryFailure)
 		}
-
-		log.Println("✓ Google Calendar sync completed successfully!")
+		slog.Error("Run failed", "error", err)
+		os.Exit(exitFailure)
 	}
-
-	// Generate ICS file
-	log.Println("Generating ICS file...")
-	generateICSFromCache()
-
-	log.Println("✓ All tasks completed successfully!")
 }
 
-// generateICSFromCache generates ICS file from cached events
-func generateICSFromCache() {
-	// Load events from JSON
-	events, err := loadExistingEvents()
+// loadConfig reads the configuration from the environment, the config file and
+// the flags in args, returning it with the remaining args
+func loadConfig(args []string) (stravacal.Config, []string, error) {
+	cfg := stravacal.Config{Settings: environment(), FromFile: make(map[string]bool)}
+
+	// Loaded first so the file can configure logging too
+	args, configPath, err := parseConfigFlag(&cfg, args)
 	if err != nil {
-		log.Fatalf("Failed to load existing events: %v", err)
+		return cfg, nil, err
 	}
-
-	// Filter for events in the next 60 days
-	now := time.Now()
-	sixtyDaysFromNow := now.AddDate(0, 0, 60)
-
-	var filteredEvents []Event
-	for _, event := range events {
-		if event.Start.After(now) && event.Start.Before(sixtyDaysFromNow) {
-			filteredEvents = append(filteredEvents, event)
+	if configPath != "" {
+		if err := loadConfigFile(&cfg, configPath); err != nil {
+			return cfg, nil, fmt.Errorf("invalid configuration: %w", err)
 		}
 	}
 
-	// Sort chronologically
-	sort.Slice(filteredEvents, func(i, j int) bool {
-		return filteredEvents[i].Start.Before(filteredEvents[j].Start)
-	})
-
-	// Generate and save ICS file
-	icsContent := generateICS(filteredEvents)
-	if err := os.WriteFile(calendarFile, []byte(icsContent), 0644); err != nil {
-		log.Fatalf("Error saving ICS file: %v", err)
+	// After the config file, so the flags override it as well as the environment
+	args, err = parseOverrideFlags(&cfg, args)
+	if err != nil {
+		return cfg, nil, err
 	}
 
-	log.Printf("Generated %s with %d events from next 60 days", calendarFile, len(filteredEvents))
-}
-
-// generateICSOnly generates only the ICS file from cached events
-func generateICSOnly() {
-	log.Println("Generating ICS file from cached events...")
-
-	// Load events from JSON
-	events, err := loadExistingEvents()
+	args, err = parseVerbosityFlags(&cfg, args)
 	if err != nil {
-		log.Fatalf("Failed to load existing events: %v", err)
+		return cfg, nil, err
 	}
+	return cfg, args, nil
+}
 
-	// Filter for events in the next 60 days
-	now := time.Now()
-	sixtyDaysFromNow := now.AddDate(0, 0, 60)
-
-	var filteredEvents []Event
-	for _, event := range events {
-		if event.Start.After(now) && event.Start.Before(sixtyDaysFromNow) {
-			filteredEvents = append(filteredEvents, event)
+// environment returns every environment variable by name
+func environment() map[string]string {
+	settings := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if name, value, found := strings.Cut(entry, "="); found {
+			settings[name] = value
 		}
 	}
-
-	// Sort chronologically
-	sort.Slice(filteredEvents, func(i, j int) bool {
-		return filteredEvents[i].Start.Before(filteredEvents[j].Start)
-	})
-
-	// Ensure output directory exists
-	if err := os.MkdirAll("output", 0755); err != nil {
-		log.Fatalf("Failed to create output directory: %v", err)
-	}
-
-	// Generate and save ICS file
-	icsContent := generateICS(filteredEvents)
-	if err := os.WriteFile(calendarFile, []byte(icsContent), 0644); err != nil {
-		log.Fatalf("Error saving ICS file: %v", err)
-	}
-
-	log.Printf("Generated %s with %d events", calendarFile, len(filteredEvents))
+	return settings
 }
 
-// syncGoogleCalendarOnly syncs cached events to Google Calendar only
-func syncGoogleCalendarOnly() {
-	log.Println("Syncing cached events to Google Calendar...")
-
-	// Load events from JSON
-	events, err := loadExistingEvents()
-	if err != nil {
-		log.Fatalf("Failed to load existing events: %v", err)
-	}
-
-	// Get Google Calendar ID from environment
-	calendarID := os.Getenv("GOOGLE_CALENDAR_ID")
-	if calendarID == "" {
-		log.Fatalf("GOOGLE_CALENDAR_ID environment variable is not set")
-	}
-
-	// Authenticate with Google Calendar
-	log.Println("Authenticating with Google Calendar...")
-	calendarService, err := getCalendarService()
-	if err != nil {
-		log.Fatalf("Failed to authenticate with Google Calendar: %v", err)
+// parseConfigFlag removes "--config PATH" (or "--config=PATH") from args, returning
+// the remaining args and PATH, or CONFIG_FILE if the flag isn't given
+func parseConfigFlag(cfg *stravacal.Config, args []string) ([]string, string, error) {
+	var rest []string
+	path := cfg.Settings["CONFIG_FILE"]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value, found := strings.CutPrefix(arg, "--config=")
+		if arg == "--config" {
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("--config requires a file path")
+			}
+			i++
+			value, found = args[i], true
+		}
+		if !found {
+			rest = append(rest, arg)
+			continue
+		}
+		path = value
 	}
+	return rest, path, nil
+}
 
-	// Filter events for next 60 days
-	now := time.Now()
-	sixtyDaysFromNow := now.AddDate(0, 0, 60)
+// overrideFlags are the command-line flags that set a variable for one run,
+// taking precedence over the environment and config file
+var overrideFlags = []struct {
+	flag     string
+	variable string
+}{
+	{"--calendar-id", "GOOGLE_CALENDAR_ID"},
+	{"--club-id", "STRAVA_CLUB_ID"},
+}
 
-	var eventsToSync []Event
-	for _, event := range events {
-		if event.Start.After(now) && event.Start.Before(sixtyDaysFromNow) {
-			eventsToSync = append(eventsToSync, event)
+// parseOverrideFlags removes overrideFlags, e.g. "--calendar-id ID" (or
+// "--calendar-id=ID"), from args and sets their variables in cfg
+func parseOverrideFlags(cfg *stravacal.Config, args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		matched := false
+		for _, override := range overrideFlags {
+			value, found := strings.CutPrefix(arg, override.flag+"=")
+			if arg == override.flag {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("%s requires a value", override.flag)
+				}
+				i++
+				value, found = args[i], true
+			}
+			if !found {
+				continue
+			}
+			if value == "" {
+				return nil, fmt.Errorf("%s requires a value", override.flag)
+			}
+			cfg.Settings[override.variable] = value
+			delete(cfg.FromFile, override.variable)
+			matched = true
+			break
+		}
+		if !matched {
+			rest = append(rest, arg)
 		}
 	}
-
-	// Sync events with Google Calendar
-	log.Printf("Syncing %d events with Google Calendar...", len(eventsToSync))
-	if err := syncStravaEvents(eventsToSync, calendarService, calendarID); err != nil {
-		log.Fatalf("Failed to sync events with Google Calendar: %v", err)
-	}
-
-	log.Println("✓ Google Calendar sync completed successfully!")
+	return rest, nil
 }
 
-// testWithSampleData tests the application with sample data from events_raw.json
-func testWithSampleData() {
-	log.Println("Testing with sample data from events_raw.json...")
-
-	data, err := os.ReadFile("output/validation/events_raw.json")
+// loadConfigFile sets the variables in a JSON config file in cfg, e.g.
+// {"STRAVA_CLUB_ID": ["123456", "789012"], "SYNC_WINDOW_DAYS": 90}
+// Variables already in the environment keep their value, so a mounted file can
+// hold the defaults and the environment override them. Values may be strings,
+// numbers, booleans, or lists joined with commas
+func loadConfigFile(cfg *stravacal.Config, path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Failed to read sample events file: %v", err)
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var stravaEvents []StravaEvent
-	if err := json.Unmarshal(data, &stravaEvents); err != nil {
-		log.Fatalf("Failed to parse sample events: %v", err)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
 	}
 
-	log.Printf("Loaded %d sample events", len(stravaEvents))
-
-	var convertedEvents []Event
-	for _, se := range stravaEvents {
-		event, err := convertStravaEvent(se)
+	var problems []error
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		value := values[name]
+		if !slices.Contains(stravacal.Variables(), name) || name == "CONFIG_FILE" {
+			problems = append(problems, fmt.Errorf("%s is not a configuration variable", name))
+			continue
+		}
+		text, err := configFileValue(value)
 		if err != nil {
-			log.Printf("Failed to convert event %d: %v", se.ID, err)
+			problems = append(problems, fmt.Errorf("%s: %w", name, err))
 			continue
 		}
-		convertedEvents = append(convertedEvents, *event)
-	}
-
-	log.Printf("Converted %d events", len(convertedEvents))
-
-	log.Println("Filtering and sorting events...")
-	finalEvents := filterAndSortEvents(convertedEvents)
-
-	log.Printf("Saving %d events to %s...", len(finalEvents), eventsFile)
-	if err := saveEvents(finalEvents); err != nil {
-		log.Fatalf("Failed to save events: %v", err)
-	}
-
-	log.Printf("Successfully saved %d events to %s", len(finalEvents), eventsFile)
-
-	for i, event := range finalEvents {
-		if i < 5 {
-			fmt.Printf("Event %d: %s - %s (%s)\n", event.ID, event.Title,
-				event.Start.Format("2006-01-02 15:04"), event.Location)
+		if cfg.Settings[name] != "" {
+			continue
 		}
+		cfg.Settings[name] = text
+		cfg.FromFile[name] = true
 	}
-	if len(finalEvents) > 5 {
-		fmt.Printf("... and %d more events\n", len(finalEvents)-5)
-	}
-}
-
-// filterEvents filters events to only include those from 7 days ago onwards
-func filterEvents(events []Event) []Event {
-	now := time.Now()
-	sevenDaysAgo := now.AddDate(0, 0, -7)
 
-	var filtered []Event
-	for _, event := range events {
-		if event.Start.After(sevenDaysAgo) {
-			filtered = append(filtered, event)
-		}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config file %s: %w", path, errors.Join(problems...))
 	}
-
-	return filtered
-}
-
-// filterAndSortEvents filters and sorts events by start time (newest first)
-func filterAndSortEvents(events []Event) []Event {
-	filtered := filterEvents(events)
-
-	// Sort events by start time in reverse chronological order (newest first)
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].Start.After(filtered[j].Start)
-	})
-
-	return filtered
+	return nil
 }
 
-// loadExistingEvents loads events from the JSON cache file
-func loadExistingEvents() ([]Event, error) {
-	if _, err := os.Stat(eventsFile); os.IsNotExist(err) {
-		return []Event{}, nil
-	}
-
-	data, err := os.ReadFile(eventsFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read events file: %w", err)
-	}
-
-	var events []Event
-	if err := json.Unmarshal(data, &events); err != nil {
-		return nil, fmt.Errorf("failed to parse events: %w", err)
-	}
-
-	// Apply phone number redaction to loaded events
-	for i := range events {
-		events[i].Description = redactPhoneNumbers(events[i].Description)
+// configFileValue returns a config file value as a variable value
+func configFileValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return fmt.Sprint(v), nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			if _, isList := item.([]any); isList {
+				return "", fmt.Errorf("lists can't be nested")
+			}
+			part, err := configFileValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = part
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("must be a string, number, boolean or list, got %T", value)
 	}
-
-	return events, nil
 }
 
-// saveEvents saves events to the JSON cache file
-func saveEvents(events []Event) error {
-	// Ensure output directory exists
-	if err := os.MkdirAll("output/events", 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
-
-	data, err := json.MarshalIndent(events, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal events: %w", err)
+// parseVerbosityFlags removes --quiet (-q) or --verbose (-v) from args, setting
+// LOG_LEVEL in cfg to ERROR or DEBUG respectively
+func parseVerbosityFlags(cfg *stravacal.Config, args []string) ([]string, error) {
+	var rest []string
+	level := ""
+	for _, arg := range args {
+		var flagLevel string
+		switch arg {
+		case "--quiet", "-q":
+			flagLevel = "ERROR"
+		case "--verbose", "-v":
+			flagLevel = "DEBUG"
+		default:
+			rest = append(rest, arg)
+			continue
+		}
+		if level != "" && level != flagLevel {
+			return nil, fmt.Errorf("--quiet and --verbose can't be used together")
+		}
+		level = flagLevel
 	}
-
-	if err := os.WriteFile(eventsFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write events file: %w", err)
+	if level != "" {
+		cfg.Settings["LOG_LEVEL"] = level
 	}
-
-	return nil
+	return rest, nil
 }
@@ -0,0 +1,189 @@
+package stravacal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stravaAuthorizeURL = "https://www.strava.com/oauth/authorize"
+
+	// stravaAuthorizeScope is the access needed to read club events
+	stravaAuthorizeScope = "read"
+
+	// defaultAuthorizePort is the local callback port when AUTHORIZE_PORT is unset
+	defaultAuthorizePort = 8765
+
+	// authorizeTimeout is how long to wait for the user to approve access
+	authorizeTimeout = 5 * time.Minute
+)
+
+// authorizationResult is the outcome of the OAuth redirect to the local server
+type authorizationResult struct {
+	code string
+	err  error
+}
+
+// getAuthorizePort returns the local port for the OAuth callback from AUTHORIZE_PORT
+func getAuthorizePort() (int, error) {
+	value := getenv("AUTHORIZE_PORT")
+	if value == "" {
+		return defaultAuthorizePort, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("AUTHORIZE_PORT must be a port number, got %q", value)
+	}
+	return port, nil
+}
+
+// authorizeStrava walks through Strava's OAuth flow to obtain a refresh token:
+// - Starts a local HTTP server to receive the redirect
+// - Prints the authorization URL for the user to open
+// - Exchanges the returned code for tokens and prints the refresh token
+// The Strava API application's Authorization Callback Domain must be "localhost"
+func authorizeStrava() error {
+	clientID := getenv("STRAVA_CLIENT_ID")
+	clientSecret, err := getSecret("CLIENT_SECRET")
+	if err != nil {
+		return err
+	}
+	if clientID == "" || clientSecret == "" {
+		return fmt.Errorf("missing required environment variables: STRAVA_CLIENT_ID, CLIENT_SECRET")
+	}
+
+	port, err := getAuthorizePort()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	timeout, err := getHTTPTimeout()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// Random state guards against forged redirects from other pages
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return fmt.Errorf("failed to generate state: %w", err)
+	}
+	state := hex.EncodeToString(stateBytes)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d: %w", port, err)
+	}
+
+	redirectURI := fmt.Sprintf("http://localhost:%d/callback", port)
+	results := make(chan authorizationResult, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var result authorizationResult
+		switch {
+		case query.Get("state") != state:
+			result.err = errors.New("authorization redirect had an unexpected state")
+		case query.Get("error") != "":
+			result.err = fmt.Errorf("authorization denied: %s", query.Get("error"))
+		case query.Get("code") == "":
+			result.err = errors.New("authorization redirect had no code")
+		default:
+			result.code = query.Get("code")
+		}
+
+		if result.err != nil {
+			http.Error(w, "Authorization failed, check the terminal for details.", http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Authorization complete, you can close this window and return to the terminal.")
+		}
+
+		select {
+		case results <- result:
+		default:
+		}
+	})
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+
+	authURL := stravaAuthorizeURL + "?" + url.Values{
+		"client_id":       {clientID},
+		"redirect_uri":    {redirectURI},
+		"response_type":   {"code"},
+		"approval_prompt": {"force"},
+		"scope":           {stravaAuthorizeScope},
+		"state":           {state},
+	}.Encode()
+
+	fmt.Println("Open this URL in your browser and approve access:")
+	fmt.Println()
+	fmt.Println("  " + authURL)
+	fmt.Println()
+	log.Printf("Waiting for Strava to redirect to %s...", redirectURI)
+
+	var result authorizationResult
+	select {
+	case result = <-results:
+	case <-time.After(authorizeTimeout):
+		return fmt.Errorf("timed out after %s waiting for authorization", authorizeTimeout)
+	}
+	if result.err != nil {
+		return result.err
+	}
+
+	tokenResp, err := exchangeAuthorizationCode(newHTTPClient(timeout), clientID, clientSecret, result.code)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Println("Authorization successful. Store this as REFRESH_TOKEN:")
+	fmt.Println()
+	fmt.Println("  " + tokenResp.RefreshToken)
+	return nil
+}
+
+// exchangeAuthorizationCode trades an OAuth authorization code for tokens
+// The authorize command runs before validation, so it passes its own client
+func exchangeAuthorizationCode(client *http.Client, clientID, clientSecret, code string) (*TokenResponse, error) {
+	form := url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+	}
+
+	resp, err := client.Post(stravaTokenURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("authorization code exchange failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokenResp.RefreshToken == "" {
+		return nil, errors.New("token response did not include a refresh token")
+	}
+
+	return &tokenResp, nil
+}
@@ -0,0 +1,145 @@
+package stravacal
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// dateRangeLayout is the format of the --from and --to dates of the backfill and past commands
+const dateRangeLayout = "2006-01-02"
+
+// parseDateRange reads the optional --from and --to dates (inclusive, in the
+// default timezone) from the arguments of the given command
+// A zero time means the range is open at that end
+func parseDateRange(command string, args []string) (from, to time.Time, err error) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	fromValue := flags.String("from", "", "earliest start date, YYYY-MM-DD")
+	toValue := flags.String("to", "", "latest start date, YYYY-MM-DD")
+	if err := flags.Parse(args); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid %s arguments: %w", command, err)
+	}
+
+	location, err := time.LoadLocation(getDefaultTimezone())
+	if err != nil {
+		location = time.UTC
+	}
+	if *fromValue != "" {
+		if from, err = time.ParseInLocation(dateRangeLayout, *fromValue, location); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("--from must be a date like 2025-01-31, got %q", *fromValue)
+		}
+	}
+	if *toValue != "" {
+		if to, err = time.ParseInLocation(dateRangeLayout, *toValue, location); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("--to must be a date like 2025-01-31, got %q", *toValue)
+		}
+		// Include events on the last day
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("--from must not be after --to")
+	}
+	return from, to, nil
+}
+
+// backfillArchive copies every cached event, past ones included, into the archive
+// calendar at ARCHIVE_CALENDAR_ID, optionally limited to events starting in [from, to)
+// Events are matched by iCalUID like the regular sync, so ones already in the
+// archive are skipped and re-running never creates duplicates. Nothing is deleted
+func backfillArchive(ctx context.Context, clubID string, from, to time.Time) error {
+	log.Println("Backfilling archive calendar from cached events...")
+
+	events, err := loadExistingEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load existing events: %w", err)
+	}
+
+	// Cancelled events never happened, so they don't belong in the archive
+	var selected []Event
+	for _, event := range events {
+		if event.CancelledAt != nil {
+			continue
+		}
+		if (!from.IsZero() && event.Start.Before(from)) || (!to.IsZero() && !event.Start.Before(to)) {
+			continue
+		}
+		selected = append(selected, event)
+	}
+	if len(selected) == 0 {
+		log.Println("No cached events to backfill")
+		return nil
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Start.Before(selected[j].Start)
+	})
+
+	calendarID := getenv("ARCHIVE_CALENDAR_ID")
+
+	log.Println("Authenticating with Google Calendar...")
+	srv, err := getCalendarService()
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with Google Calendar: %w", err)
+	}
+	if err := checkCalendarAccess(ctx, srv, calendarID); err != nil {
+		return err
+	}
+
+	// Find the events already in the archive across the whole range
+	timeMin := selected[0].Start.Add(-24 * time.Hour).Format(time.RFC3339)
+	timeMax := selected[len(selected)-1].End.Add(24 * time.Hour).Format(time.RFC3339)
+	existingUIDs := make(map[string]bool)
+	err = withCalendarRetry(ctx, "list archive calendar events", func() error {
+		return srv.Events.List(calendarID).
+			Context(ctx).
+			TimeMin(timeMin).
+			TimeMax(timeMax).
+			SingleEvents(true).
+			Pages(ctx, func(page *calendar.Events) error {
+				for _, item := range page.Items {
+					existingUIDs[item.ICalUID] = true
+				}
+				return nil
+			})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve archive calendar events: %w", err)
+	}
+
+	syncTime := time.Now()
+	if loc, err := time.LoadLocation(getDefaultTimezone()); err == nil {
+		syncTime = syncTime.In(loc)
+	}
+
+	var operations []calendarOperation
+	for _, event := range selected {
+		uid := eventUID(event)
+		if existingUIDs[uid] {
+			continue
+		}
+		newEvent := createGoogleCalendarEvent(event, clubID, syncTime.Format("Mon, 2 Jan @ 3:04 PM"))
+		operations = append(operations, newCreateOperation(calendarID, newEvent,
+			"event_id", event.ID, "uid", uid, "title", event.Title, "start", event.Start.In(eventLocation(event)).Format("Mon 2 Jan 2006")))
+	}
+
+	log.Printf("%d of %d events are already in the archive, adding %d", len(selected)-len(operations), len(selected), len(operations))
+
+	failed := 0
+	for _, err := range executeCalendarOperations(ctx, srv, operations, nil) {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d events failed to backfill", failed, len(operations))
+	}
+
+	log.Println("✓ Backfill completed successfully!")
+	return nil
+}
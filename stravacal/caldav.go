@@ -0,0 +1,281 @@
+package stravacal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// calDAVFingerprintProperty records the fingerprint of what was written in each
+// event, so unchanged events aren't rewritten every sync
+const calDAVFingerprintProperty = "X-STRAVA-SYNC-FINGERPRINT"
+
+// calDAVQuery asks a CalDAV collection for every event with its ETag and data
+const calDAVQuery = `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>
+  <C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VEVENT"/></C:comp-filter></C:filter>
+</C:calendar-query>`
+
+// calDAVMultistatus is the response to calDAVQuery (RFC 4791)
+type calDAVMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ETag         string `xml:"DAV: getetag"`
+				CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// calDAVSink is a CalDAV calendar collection, such as a Nextcloud, Fastmail or
+// iCloud calendar, with each occurrence stored as <uid>.ics
+type calDAVSink struct {
+	collection *url.URL
+	username   string
+	password   string
+	clubID     string
+}
+
+// getCalDAVSink returns the CalDAV collection at CALDAV_URL, authenticated with
+// CALDAV_USERNAME and CALDAV_PASSWORD, or nil when CALDAV_URL is unset
+func getCalDAVSink() (*calDAVSink, error) {
+	value := getenv("CALDAV_URL")
+	if value == "" {
+		return nil, nil
+	}
+	collection, err := url.Parse(value)
+	if err != nil || (collection.Scheme != "http" && collection.Scheme != "https") || collection.Host == "" {
+		return nil, fmt.Errorf("CALDAV_URL must be an http or https URL, got %q", value)
+	}
+	// Event paths are resolved relative to the collection
+	if !strings.HasSuffix(collection.Path, "/") {
+		collection.Path += "/"
+	}
+	password, err := getSecret("CALDAV_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+	return &calDAVSink{collection: collection, username: getenv("CALDAV_USERNAME"), password: password}, nil
+}
+
+// calDAVSinkFor returns the CalDAV collection for the events of clubID, or nil
+// when CALDAV_URL is unset
+func calDAVSinkFor(clubID string) *calDAVSink {
+	if validated().calDAV == nil {
+		return nil
+	}
+	sink := *validated().calDAV
+	sink.clubID = clubID
+	return &sink
+}
+
+// Name returns the collection URL, without any password in it
+func (c *calDAVSink) Name() string {
+	return "CalDAV " + c.collection.Redacted()
+}
+
+// ListManaged returns the events in the collection with an @strava.com UID
+func (c *calDAVSink) ListManaged(ctx context.Context) ([]sinkEvent, error) {
+	resp, err := c.request(ctx, "REPORT", c.collection, calDAVQuery, map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        "1",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("calendar query failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var multistatus calDAVMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&multistatus); err != nil {
+		return nil, fmt.Errorf("failed to parse calendar query response: %w", err)
+	}
+
+	var events []sinkEvent
+	for _, response := range multistatus.Responses {
+		for _, propstat := range response.Propstat {
+			if !strings.Contains(propstat.Status, " 200 ") || propstat.Prop.CalendarData == "" {
+				continue
+			}
+			properties := calDAVEventProperties(propstat.Prop.CalendarData)
+			if !strings.HasSuffix(properties["UID"], "@strava.com") {
+				continue
+			}
+			href, err := c.collection.Parse(response.Href)
+			if err != nil {
+				return nil, fmt.Errorf("invalid event href %q: %w", response.Href, err)
+			}
+			events = append(events, sinkEvent{
+				UID:         properties["UID"],
+				Title:       properties["SUMMARY"],
+				Href:        href.String(),
+				ETag:        propstat.Prop.ETag,
+				Fingerprint: properties[calDAVFingerprintProperty],
+			})
+		}
+	}
+	return events, nil
+}
+
+// Fingerprint returns a hash of the calendar object written for event
+func (c *calDAVSink) Fingerprint(event Event) string {
+	sum := sha256.Sum256([]byte(c.eventBody(event)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Changes compares the fingerprint stored in existing, since the calendar
+// object itself may be rewritten by the server
+func (c *calDAVSink) Changes(existing sinkEvent, event Event) []string {
+	if expected := c.Fingerprint(event); existing.Fingerprint != expected {
+		return []string{fmt.Sprintf("content %q -> %q", existing.Fingerprint, expected)}
+	}
+	return nil
+}
+
+// Create writes event as <uid>.ics, only if no event exists there yet
+func (c *calDAVSink) Create(ctx context.Context, event Event) error {
+	target := c.collection.JoinPath(eventUID(event) + ".ics")
+	return c.put(ctx, target, event, map[string]string{"If-None-Match": "*"})
+}
+
+// Update writes event over existing, only if it still has the ETag it was
+// listed with, so events changed on the server since aren't overwritten
+func (c *calDAVSink) Update(ctx context.Context, existing sinkEvent, event Event) error {
+	target, err := url.Parse(existing.Href)
+	if err != nil {
+		return fmt.Errorf("invalid event href %q: %w", existing.Href, err)
+	}
+	headers := map[string]string{}
+	if existing.ETag != "" {
+		headers["If-Match"] = existing.ETag
+	}
+	return c.put(ctx, target, event, headers)
+}
+
+// put writes the calendar object for event to target
+func (c *calDAVSink) put(ctx context.Context, target *url.URL, event Event, headers map[string]string) error {
+	headers["Content-Type"] = "text/calendar; charset=utf-8"
+
+	// The fingerprint is stored in the event itself, since CalDAV has nowhere else
+	fingerprint := fmt.Sprintf("%s:%s\r\nEND:VEVENT\r\n", calDAVFingerprintProperty, c.Fingerprint(event))
+	body := strings.Replace(c.eventBody(event), "END:VEVENT\r\n", fingerprint, 1)
+
+	resp, err := c.request(ctx, http.MethodPut, target, body, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("event changed on the server since it was listed, retrying next sync")
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("PUT failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+// Delete removes an event, if it still has the ETag it was listed with
+func (c *calDAVSink) Delete(ctx context.Context, existing sinkEvent) error {
+	target, err := url.Parse(existing.Href)
+	if err != nil {
+		return fmt.Errorf("invalid event href %q: %w", existing.Href, err)
+	}
+	headers := map[string]string{}
+	if existing.ETag != "" {
+		headers["If-Match"] = existing.ETag
+	}
+
+	resp, err := c.request(ctx, http.MethodDelete, target, "", headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("event changed on the server since it was listed, retrying next sync")
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("DELETE failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+}
+
+// eventBody returns the calendar object for one occurrence, from the same
+// VEVENT as the ICS file but without the sync time, so it only changes when
+// the event does
+func (c *calDAVSink) eventBody(event Event) string {
+	var body strings.Builder
+	body.WriteString("BEGIN:VCALENDAR\r\n")
+	body.WriteString("VERSION:2.0\r\n")
+	body.WriteString(foldLine("PRODID:"+escapeICSText(getCalendarProdID())) + "\r\n")
+	body.WriteString(generateVTimezones([]Event{event}))
+	body.WriteString(formatVEvent(event, c.clubID, eventUID(event), "", getICSReminders(), time.Time{}))
+	body.WriteString("END:VCALENDAR\r\n")
+	return body.String()
+}
+
+// request sends a request to the CalDAV server with basic authentication
+func (c *calDAVSink) request(ctx context.Context, method string, target *url.URL, body string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), strings.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, target.Redacted(), err)
+	}
+	return resp, nil
+}
+
+// calDAVEventProperties returns the properties of the first VEVENT in a
+// calendar object, e.g. "UID", unescaped and without parameters
+func calDAVEventProperties(data string) map[string]string {
+	// Unfold continuation lines before splitting
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	properties := make(map[string]string)
+	inEvent := false
+	for _, line := range strings.Split(data, "\n") {
+		switch {
+		case line == "BEGIN:VEVENT":
+			inEvent = true
+		case line == "END:VEVENT":
+			return properties
+		case inEvent:
+			name, value, found := strings.Cut(line, ":")
+			if !found {
+				continue
+			}
+			name, _, _ = strings.Cut(name, ";")
+			if _, seen := properties[name]; !seen {
+				properties[name] = unescapeICSText(value)
+			}
+		}
+	}
+	return properties
+}
@@ -0,0 +1,135 @@
+package stravacal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	// checkpointFile records the progress of Google Calendar syncs, relative to
+	// OUTPUT_DIR; excluded from the GitHub Pages deploy with the rest of cache/
+	checkpointFile = "cache/sync-checkpoint.json"
+
+	// checkpointMaxAge is how long an interrupted sync can be resumed; older
+	// checkpoints are ignored and the sync starts afresh
+	checkpointMaxAge = 24 * time.Hour
+)
+
+// syncCheckpoint is the progress of a Google Calendar sync that was interrupted
+// A resumed sync reuses the interrupted sync's time, so the events it wrote
+// match as up to date and only the changes it didn't get to are made. Creates
+// and deletes in Done aren't repeated even if the calendar doesn't list them yet
+type syncCheckpoint struct {
+	CalendarID string    `json:"calendar_id"`
+	StartedAt  time.Time `json:"started_at"`
+	SyncTime   string    `json:"sync_time"` // The sync time written in descriptions
+	Done       []string  `json:"done"`      // UIDs of events created, updated or deleted so far
+}
+
+// loadCheckpoints reads the checkpoints of unfinished syncs by calendar ID
+func loadCheckpoints() (map[string]*syncCheckpoint, error) {
+	checkpoints := make(map[string]*syncCheckpoint)
+	data, err := os.ReadFile(outputPath(checkpointFile))
+	if os.IsNotExist(err) {
+		return checkpoints, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		return nil, fmt.Errorf("failed to parse sync checkpoint: %w", err)
+	}
+	return checkpoints, nil
+}
+
+// saveCheckpoint records checkpoint, or removes the calendar's checkpoint when
+// checkpoint is nil, keeping those of other calendars
+func saveCheckpoint(calendarID string, checkpoint *syncCheckpoint) error {
+	checkpoints, err := loadCheckpoints()
+	if err != nil {
+		// An unreadable checkpoint is replaced rather than blocking every sync
+		checkpoints = make(map[string]*syncCheckpoint)
+	}
+	if checkpoint == nil {
+		delete(checkpoints, calendarID)
+	} else {
+		checkpoints[calendarID] = checkpoint
+	}
+
+	if len(checkpoints) == 0 {
+		if err := os.Remove(outputPath(checkpointFile)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove sync checkpoint: %w", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync checkpoint: %w", err)
+	}
+	return writeOutputFile(checkpointFile, data)
+}
+
+// startCheckpoint returns the checkpoint for a sync of calendarID, resuming an
+// interrupted sync from the last checkpointMaxAge or starting one at syncTime
+func startCheckpoint(calendarID string, syncTime string, now time.Time) *syncCheckpoint {
+	checkpoints, err := loadCheckpoints()
+	if err != nil {
+		slog.Warn("Ignoring unreadable sync checkpoint", "error", err)
+	}
+	if previous := checkpoints[calendarID]; previous != nil && now.Sub(previous.StartedAt) < checkpointMaxAge {
+		log.Printf("Resuming sync of %s interrupted after %d changes (started %s)",
+			calendarID, len(previous.Done), previous.StartedAt.Format(time.RFC3339))
+		return previous
+	}
+
+	checkpoint := &syncCheckpoint{CalendarID: calendarID, StartedAt: now.UTC(), SyncTime: syncTime, Done: []string{}}
+	if err := saveCheckpoint(calendarID, checkpoint); err != nil {
+		slog.Warn("Failed to save sync checkpoint", "error", err)
+	}
+	return checkpoint
+}
+
+// isDone reports whether the change to the event with uid was made before the
+// sync was interrupted; always false without a checkpoint
+func (c *syncCheckpoint) isDone(uid string) bool {
+	return c != nil && slices.Contains(c.Done, uid)
+}
+
+// recordDone adds uids to the checkpoint once their changes are made; nothing
+// is recorded without a checkpoint
+func (c *syncCheckpoint) recordDone(uids []string) {
+	if c == nil {
+		return
+	}
+	for _, uid := range uids {
+		if !slices.Contains(c.Done, uid) {
+			c.Done = append(c.Done, uid)
+		}
+	}
+	if err := saveCheckpoint(c.CalendarID, c); err != nil {
+		slog.Warn("Failed to save sync checkpoint", "error", err)
+	}
+}
+
+// resumableSyncError reports whether a sync that failed with err can be resumed:
+// it was cancelled or out of time, or failed with a TemporaryError or a
+// transient Google Calendar error. Other failures would happen again
+func resumableSyncError(err error) bool {
+	var temporary *TemporaryError
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &temporary) || isRetryableCalendarError(err)
+}
+
+// finish removes the checkpoint once the sync is done or can't be resumed
+func (c *syncCheckpoint) finish() {
+	if err := saveCheckpoint(c.CalendarID, nil); err != nil {
+		slog.Warn("Failed to remove sync checkpoint", "error", err)
+	}
+}
@@ -0,0 +1,59 @@
+package stravacal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSyncSinkResumesCheckpoint(t *testing.T) {
+	withSettings(t, map[string]string{"OUTPUT_DIR": t.TempDir()})
+	events, uids := sinkTestEvents()
+
+	// The interrupted sync wrote the first occurrence, which Strava changed
+	// since, and created the second, which the calendar doesn't list yet
+	checkpoint := startCheckpoint("fake", "Tue, 7 Jan @ 6:00 PM", time.Now())
+	checkpoint.recordDone(uids[:2])
+	sink := newFakeSink(sinkEvent{UID: uids[0], Title: "Old title"})
+
+	report, err := syncSink(context.Background(), sink, events[:3], false, checkpoint)
+	if err != nil {
+		t.Fatalf("syncSink: %v", err)
+	}
+	if want := []string{"update " + uids[0], "create " + uids[2]}; !slices.Equal(sink.calls, want) {
+		t.Errorf("changes = %q, want the Strava edit and the create the interrupted sync didn't make", sink.calls)
+	}
+	if report.Updated != 1 || report.Created != 1 || report.Skipped != 1 {
+		t.Errorf("report %+v, want the done create skipped", report)
+	}
+
+	checkpoints, err := loadCheckpoints()
+	if err != nil {
+		t.Fatalf("loadCheckpoints: %v", err)
+	}
+	if done := checkpoints["fake"].Done; !slices.Equal(done, uids[:3]) {
+		t.Errorf("checkpoint done = %q, want %q", done, uids[:3])
+	}
+}
+
+func TestResumableSyncError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("calendar not found"), false},
+		{fmt.Errorf("1 calendar changes failed: %w", errors.New("conflict")), false},
+		{context.Canceled, true},
+		{fmt.Errorf("sync: %w", context.DeadlineExceeded), true},
+		{&TemporaryError{Err: errors.New("unavailable")}, true},
+	}
+	for _, tt := range tests {
+		if got := resumableSyncError(tt.err); got != tt.want {
+			t.Errorf("resumableSyncError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
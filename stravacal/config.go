@@ -0,0 +1,394 @@
+package stravacal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// configVariable describes an environment variable read by the program
+type configVariable struct {
+	name        string
+	description string
+	requiredBy  []string // Commands that can't run without it ("" is the full sync)
+}
+
+// stravaCommands are the commands that fetch events from the Strava API
+var stravaCommands = []string{"", "dry-run", "serve", "explain", "past", "list-synced", "doctor"}
+
+// configVariables lists every environment variable, required ones first
+var configVariables = []configVariable{
+	{"STRAVA_CLIENT_ID", "Strava OAuth client ID", stravaCommands},
+	{"STRAVA_CLUB_ID", "Strava club ID to fetch events from (comma-separated for several clubs)", []string{"", "dry-run", "test", "ics", "gcal", "ics-validate", "serve", "backfill", "explain", "past", "list-synced", "doctor"}},
+	{"CLIENT_SECRET", "Strava OAuth client secret", stravaCommands},
+	{"REFRESH_TOKEN", "Strava OAuth refresh token", stravaCommands},
+	{"GOOGLE_CALENDAR_ID", "Target Google Calendar ID (Google Calendar sync is skipped without it)", []string{"dry-run", "gcal", "list-synced", "prune"}},
+	{"GOOGLE_PUBLIC_CALENDAR_ID", "Second Google Calendar synced without leader names or contact details", nil},
+	{"ARCHIVE_CALENDAR_ID", "Google Calendar ID the backfill command copies cached events into", []string{"backfill"}},
+	{"GOOGLE_AUTH_MODE", "service_account (default) or oauth", nil},
+	{"GOOGLE_SERVICE_ACCOUNT", "Google service account JSON, raw or base64-encoded (falls back to service-account.json)", nil},
+	{"CLIENT_SECRET_FILE", "File holding CLIENT_SECRET, e.g. a Docker secret (takes precedence)", nil},
+	{"REFRESH_TOKEN_FILE", "File holding REFRESH_TOKEN (takes precedence)", nil},
+	{"GOOGLE_SERVICE_ACCOUNT_FILE", "File holding GOOGLE_SERVICE_ACCOUNT (takes precedence)", nil},
+	{"GOOGLE_OAUTH_CLIENT_ID", "Google OAuth client ID (oauth mode)", nil},
+	{"GOOGLE_OAUTH_CLIENT_SECRET", "Google OAuth client secret (oauth mode)", nil},
+	{"GOOGLE_OAUTH_REFRESH_TOKEN", "Google OAuth refresh token (oauth mode)", nil},
+	{"CALDAV_URL", "CalDAV calendar collection URL to sync events to as well", nil},
+	{"CALDAV_USERNAME", "CalDAV username", nil},
+	{"CALDAV_PASSWORD", "CalDAV password or app password", nil},
+	{"CALDAV_PASSWORD_FILE", "File holding CALDAV_PASSWORD (takes precedence)", nil},
+	{"STORE", "Event cache backend: json (default) or sqlite (needs a build with -tags sqlite)", nil},
+	{"OUTPUT_DIR", "Directory for generated files and caches (default output)", nil},
+	{"SYNC_WINDOW_DAYS", "Number of days ahead to sync (default 60)", nil},
+	{"FILTER_SINCE_DAYS", "Number of days of past events to keep (default 7)", nil},
+	{"FETCH_CONCURRENCY", "Number of clubs fetched from Strava at once (default 2)", nil},
+	{"HTTP_TIMEOUT", "Timeout for each Strava and Google request, e.g. 45s (default 30s)", nil},
+	{"RUN_TIMEOUT", "Deadline for a whole run, or each sync in server mode (default 15m, 0 for none)", nil},
+	{"MAX_EVENTS", "Abort if Strava returns more events than this (default 1000, 0 for no limit)", nil},
+	{"DELETE_GRACE_RUNS", "Consecutive runs an event must be missing before it is deleted (default 1)", nil},
+	{"DEFAULT_TIMEZONE", "Timezone for events without one from Strava (default Europe/London)", nil},
+	{"DEFAULT_EVENT_DURATION_MINUTES", "Estimated event length (default 60)", nil},
+	{"EVENT_DURATION_OVERRIDES", "Per-activity estimated lengths", nil},
+	{"DURATION_MODE", "fixed (default) or estimate-from-distance to estimate lengths from route distance", nil},
+	{"ACTIVITY_PACES", "Per-activity average paces in minutes per km", nil},
+	{"END_TIME", "estimated (default) or none to publish events without an end time", nil},
+	{"GEOCODER", "nominatim or google to name meeting points that only have coordinates", nil},
+	{"GEOCODER_URL", "Geocoding endpoint override", nil},
+	{"GOOGLE_GEOCODING_API_KEY", "Google Geocoding API key", nil},
+	{"INCLUDE_WOMEN_ONLY", "Set to false to leave out women-only events", nil},
+	{"PRIVATE_EVENTS", "include (default), exclude or only private events", nil},
+	{"EXCLUDE_EVENT_IDS", "Comma-separated Strava event IDs to leave out", nil},
+	{"EXCLUDE_TITLE_REGEX", "Leave out events whose title matches this regular expression", nil},
+	{"EVENT_VISIBILITY", "strava (default, private for Strava's private events), public, private or default", nil},
+	{"TENTATIVE_TITLE_REGEX", "Titles of provisional events, shown as tentative (default: starting [TBC])", nil},
+	{"TITLE_TAG_REGEX", "Tags in event titles, e.g. [Social], added as ICS categories and to descriptions", nil},
+	{"ACTIVITY_PREFIX_MAP", "Per-activity title prefixes, e.g. Run=🏃,Ride=🚴", nil},
+	{"ICS_PREVIEW", "Set to true to move provisional events from calendar.ics to calendar-preview.ics", nil},
+	{"ICS_SPLIT_BY", "activity, terrain or skill to also write one ICS file per value to calendars/", nil},
+	{"MERGE_CLUB_DUPLICATES", "Set to true to merge runs posted to several clubs into one event", nil},
+	{"ADOPT_MANUAL_EVENTS", "Set to true to adopt matching manually created calendar events", nil},
+	{"UNITS", "metric (default) or imperial distances", nil},
+	{"PHONE_REGION", "Phone number formats to redact: UK (default), US, INTL", nil},
+	{"ALL_DAY_MIDNIGHT_EVENTS", "Set to false to keep midnight events at their time instead of all day", nil},
+	{"TERRAIN_COLORS", "Google Calendar color IDs by terrain", nil},
+	{"EVENT_REMINDERS", "Google Calendar reminders, e.g. popup=60,email=1440", nil},
+	{"DESCRIPTION_TEMPLATE", "Go template for event descriptions", nil},
+	{"DESCRIPTION_TEMPLATE_FILE", "File containing the description template", nil},
+	{"GOOGLE_DESCRIPTION_FORMAT", "text (default) or html to keep Strava's formatting in Google Calendar", nil},
+	{"ICS_CALENDAR_NAME", "Calendar title (default Malvern Buzzards Running Club)", nil},
+	{"ICS_CALENDAR_DESC", "Calendar description", nil},
+	{"ICS_PRODID", "ICS producer identifier", nil},
+	{"ICS_REMINDERS", "ICS alarms as durations before the start, e.g. P1D,PT1H", nil},
+	{"ICS_DAY_SUMMARY", "off (default), add or only for an all-day overview of each day's events in the ICS file", nil},
+	{"STABLE_TIMESTAMPS", "Set to true to leave the generation time out of the ICS file", nil},
+	{"AUTHORIZE_PORT", "Local callback port for the authorize command (default 8765)", nil},
+	{"SLACK_WEBHOOK_URL", "Slack incoming webhook posted a summary of each sync's changes", nil},
+	{"NOTIFY_WEBHOOK_URL", "Other webhook (e.g. Discord) posted the same summary", nil},
+	{"HEARTBEAT_URL", "Healthcheck URL pinged after each run", nil},
+	{"SYNC_SECRET", "Shared secret required by POST /sync in server mode", []string{"serve"}},
+	{"SERVE_PORT", "Port for the serve command (default 8080)", nil},
+	{"SMTP_HOST", "Mail server for the digest command", nil},
+	{"SMTP_PORT", "Mail server port, with STARTTLS when offered (default 587)", nil},
+	{"SMTP_USERNAME", "Mail server username, if it needs authentication", nil},
+	{"SMTP_PASSWORD", "Mail server password", nil},
+	{"SMTP_FROM", "Sender address of the digest", nil},
+	{"SMTP_TO", "Comma-separated recipients of the digest", nil},
+	{"LOG_FORMAT", "text (default) or json", nil},
+	{"LOG_LEVEL", "DEBUG, INFO (default), WARN or ERROR", nil},
+	{"CONFIG_FILE", "JSON file of these variables, overridden by the environment (same as --config)", nil},
+}
+
+// secretVariables are the variables that can be read from the file named by
+// <name>_FILE instead, such as a Docker secret, keeping them out of process listings
+var secretVariables = []string{"CLIENT_SECRET", "REFRESH_TOKEN", "GOOGLE_SERVICE_ACCOUNT", "CALDAV_PASSWORD"}
+
+// getSecret returns a secret variable, read from the file named by <name>_FILE
+// when that is set and from the environment otherwise. Trailing whitespace,
+// such as the newline editors add, is trimmed from the file
+func getSecret(name string) (string, error) {
+	path := getenv(name + "_FILE")
+	if path == "" {
+		return getenv(name), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+	}
+	return strings.TrimRight(string(data), " \t\r\n"), nil
+}
+
+// variableSet reports whether a variable has a value, counting <name>_FILE for
+// secretVariables
+func variableSet(name string) bool {
+	if slices.Contains(secretVariables, name) && getenv(name+"_FILE") != "" {
+		return true
+	}
+	return getenv(name) != ""
+}
+
+// validateConfig checks the configuration for the given command ("" is the full sync)
+// Every missing required variable and invalid value is reported in one error,
+// rather than failing on the first one partway through a sync
+func validateConfig(command string) error {
+	var required []string
+	for _, variable := range configVariables {
+		if slices.Contains(variable.requiredBy, command) {
+			required = append(required, variable.name)
+		}
+	}
+	return validateSettings(required...)
+}
+
+// settings are the values of a Config, parsed once by validateSettings so
+// they are read without handling errors validation already reported
+type settings struct {
+	clubIDs             []string // Unset for the commands that don't need STRAVA_CLUB_ID
+	clubID              string   // The primary club, shown for cached events that don't record their own
+	store               string
+	fetchConcurrency    int
+	runTimeout          time.Duration
+	httpTimeout         time.Duration
+	windowDays          int
+	filterSinceDays     int
+	deleteGraceRuns     int
+	maxEvents           int
+	durationMode        string
+	activityPaces       map[string]float64
+	endTimeMode         string
+	includeWomenOnly    bool
+	privateEvents       string
+	excludedEventIDs    map[int64]bool
+	excludeTitle        *regexp.Regexp
+	visibility          string
+	tentativeTitle      *regexp.Regexp
+	titleTag            *regexp.Regexp
+	activityPrefixes    map[string]string
+	icsPreview          bool
+	icsSplitBy          string
+	units               string
+	phoneRegions        []string
+	allDayMidnight      bool
+	mergeClubDuplicates bool
+	adoptManual         bool
+	terrainColors       map[int]string
+	description         *template.Template
+	descriptionFormat   string
+	reminders           *calendar.EventReminders
+	icsDaySummary       string
+	stableTimestamps    bool
+	servePort           int
+	smtpPort            int
+	calDAV              *calDAVSink
+}
+
+// validated returns the settings of the Config in use, as parsed by
+// validateSettings. Every command and exported function validates first, so
+// reading them before that is a bug
+func validated() *settings {
+	s := current().settings
+	if s == nil {
+		panic("stravacal: settings read before the Config was validated")
+	}
+	return s
+}
+
+// validateSettings checks every value of the Config in use, and that the
+// required variables are set. When they're valid, the parsed values are kept
+// on the Config for validated
+func validateSettings(required ...string) error {
+	var problems []error
+	s := &settings{}
+	var err error
+
+	var missing []string
+	for _, name := range required {
+		if !variableSet(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", ")))
+	}
+
+	for _, name := range secretVariables {
+		if _, err := getSecret(name); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if key, err := getSecret("GOOGLE_SERVICE_ACCOUNT"); err == nil && key != "" {
+		if _, err := decodeServiceAccountKey(key); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	if s.calDAV, err = getCalDAVSink(); err != nil {
+		problems = append(problems, err)
+	}
+
+	if publicID := getenv("GOOGLE_PUBLIC_CALENDAR_ID"); publicID != "" && publicID == getenv("GOOGLE_CALENDAR_ID") {
+		problems = append(problems, fmt.Errorf("GOOGLE_PUBLIC_CALENDAR_ID must be a different calendar from GOOGLE_CALENDAR_ID"))
+	}
+	if getenv("STRAVA_CLUB_ID") != "" {
+		if s.clubIDs, err = getClubIDs(); err != nil {
+			problems = append(problems, err)
+		} else {
+			s.clubID = s.clubIDs[0]
+		}
+	}
+	if s.store, err = getStore(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.fetchConcurrency, err = getFetchConcurrency(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.runTimeout, err = getRunTimeout(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.httpTimeout, err = getHTTPTimeout(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.windowDays, err = getSyncWindowDays(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.filterSinceDays, err = getFilterSinceDays(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.deleteGraceRuns, err = getDeleteGraceRuns(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.maxEvents, err = getMaxEvents(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := time.LoadLocation(getDefaultTimezone()); err != nil {
+		problems = append(problems, fmt.Errorf("DEFAULT_TIMEZONE: %w", err))
+	}
+	if _, err := getEventDuration(""); err != nil {
+		problems = append(problems, err)
+	}
+	if s.durationMode, err = getDurationMode(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.activityPaces, err = getActivityPaces(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.endTimeMode, err = getEndTimeMode(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.includeWomenOnly, err = getIncludeWomenOnly(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.privateEvents, err = getPrivateEventsFilter(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.excludedEventIDs, err = getExcludedEventIDs(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.excludeTitle, err = getExcludeTitlePattern(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.visibility, err = getEventVisibility(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.tentativeTitle, err = getTentativeTitlePattern(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.titleTag, err = getTitleTagPattern(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.activityPrefixes, err = getActivityPrefixes(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.icsPreview, err = getICSPreview(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.icsSplitBy, err = getICSSplitBy(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := getGoogleAuthMode(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.units, err = getUnits(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.phoneRegions, err = getPhoneRegions(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.allDayMidnight, err = getAllDayMidnightEvents(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.mergeClubDuplicates, err = getMergeClubDuplicates(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.adoptManual, err = getAdoptManualEvents(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := getGeocoder(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.terrainColors, err = getTerrainColors(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.description, err = getDescriptionTemplate(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.descriptionFormat, err = getGoogleDescriptionFormat(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.reminders, err = getEventReminders(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.icsDaySummary, err = getICSDaySummary(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.stableTimestamps, err = getStableTimestamps(); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := getAuthorizePort(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.servePort, err = getServePort(); err != nil {
+		problems = append(problems, err)
+	}
+	if s.smtpPort, err = getSMTPPort(); err != nil {
+		problems = append(problems, err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
+	}
+	current().settings = s
+	return nil
+}
+
+// checkConfig prints the status of every environment variable for the full sync
+// and returns an error if the configuration is invalid
+func checkConfig() error {
+	fmt.Println("Configuration:")
+	for _, variable := range configVariables {
+		required := slices.Contains(variable.requiredBy, "")
+		switch {
+		case current().FromFile[variable.name]:
+			fmt.Printf("  ✓ %-30s set (config file)\n", variable.name)
+		case variableSet(variable.name):
+			fmt.Printf("  ✓ %-30s set\n", variable.name)
+		case required:
+			fmt.Printf("  ✗ %-30s missing (required) - %s\n", variable.name, variable.description)
+		default:
+			fmt.Printf("  - %-30s not set (optional) - %s\n", variable.name, variable.description)
+		}
+	}
+	fmt.Println()
+
+	if err := validateConfig(""); err != nil {
+		return err
+	}
+	fmt.Println("✓ Configuration is valid")
+	return nil
+}
@@ -0,0 +1,158 @@
+package stravacal
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultDescriptionTemplate is the event description used by Google Calendar
+// and the ICS file unless DESCRIPTION_TEMPLATE or DESCRIPTION_TEMPLATE_FILE is set
+const defaultDescriptionTemplate = `{{with .Details}}{{join . "\n"}}
+
+{{end}}{{with .Description}}{{.}}
+
+{{end}}{{with .MapURL}}Meeting point: {{.}}
+
+{{end}}{{with .PhotoURL}}Photo: {{.}}
+
+{{end}}View on Strava: {{.URL}}
+
+Synced from Strava Club {{.ClubID}}{{with .SyncTime}} on {{.}}{{end}}`
+
+// descriptionFuncs are the functions available to description templates
+var descriptionFuncs = template.FuncMap{"join": strings.Join}
+
+// defaultDescription is defaultDescriptionTemplate, parsed
+var defaultDescription = template.Must(template.New("description").Funcs(descriptionFuncs).Parse(defaultDescriptionTemplate))
+
+// descriptionData is what a description template can show about an event
+// Fields are empty when Strava doesn't provide them, and Tags are the title
+// tags matched by TITLE_TAG_REGEX
+type descriptionData struct {
+	Title         string
+	Start         time.Time // In the event's timezone
+	Organizer     string
+	SkillLevel    string // e.g. "Beginner, Intermediate"
+	Terrain       string // e.g. "Trail"
+	Distance      string // e.g. "8.0 km"
+	EstimatedTime string // e.g. "45 min (5:38 /km)"
+	Attending     string // e.g. "12 attending"
+	Duration      string // e.g. "Duration: about 60 min (estimated)"
+	OtherClubs    string // e.g. "Also posted to Strava Club 456", with MERGE_CLUB_DUPLICATES
+	Details       []string
+	Tags          []string
+	Description   string
+	Location      string
+	MapURL        string // Google Maps link to the meeting point
+	PhotoURL      string
+	URL           string // The event on Strava
+	ClubID        string
+	SyncTime      string // e.g. "Mon, 2 Jan @ 3:04 PM", empty in stable ICS files
+}
+
+// getDescriptionTemplate returns the template event descriptions are built
+// from: DESCRIPTION_TEMPLATE, else the contents of DESCRIPTION_TEMPLATE_FILE,
+// else defaultDescriptionTemplate
+func getDescriptionTemplate() (*template.Template, error) {
+	text := getenv("DESCRIPTION_TEMPLATE")
+	source := "DESCRIPTION_TEMPLATE"
+	if path := getenv("DESCRIPTION_TEMPLATE_FILE"); text == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DESCRIPTION_TEMPLATE_FILE: %w", err)
+		}
+		// Editors end files with a newline, which isn't part of the description
+		text = strings.TrimRight(string(data), "\r\n")
+		source = "DESCRIPTION_TEMPLATE_FILE"
+	}
+	if text == "" {
+		return defaultDescription, nil
+	}
+
+	tmpl, err := template.New("description").Funcs(descriptionFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid template: %w", source, err)
+	}
+	// Fields that don't exist are only reported when executed
+	if err := tmpl.Execute(&strings.Builder{}, descriptionData{}); err != nil {
+		return nil, fmt.Errorf("%s is not a valid template: %w", source, err)
+	}
+	return tmpl, nil
+}
+
+// buildEventDescription creates a formatted description for an event from the
+// description template
+func buildEventDescription(event Event, clubID string, syncTime string) string {
+	data := newDescriptionData(event, clubID, syncTime)
+
+	var description strings.Builder
+	if err := validated().description.Execute(&description, data); err != nil {
+		slog.Warn("Description template failed, using the default", "event_id", event.ID, "error", err)
+		description.Reset()
+		defaultDescription.Execute(&description, data)
+	}
+	return description.String()
+}
+
+// newDescriptionData collects the fields a description template can show
+func newDescriptionData(event Event, clubID string, syncTime string) descriptionData {
+	if event.ClubID != "" {
+		clubID = event.ClubID
+	}
+	data := descriptionData{
+		Title:       event.Title,
+		Start:       event.Start.In(eventLocation(event)),
+		Organizer:   event.Organizer,
+		SkillLevel:  getSkillLevelString(event.SkillLevels),
+		Terrain:     getTerrainString(event.Terrain),
+		Distance:    formatDistance(event.Distance),
+		Duration:    formatDurationDetail(event),
+		OtherClubs:  formatDuplicateClubs(event),
+		Tags:        eventTags(event),
+		Description: event.Description,
+		Location:    event.Location,
+		MapURL:      getMapURL(event),
+		PhotoURL:    event.PhotoURL,
+		URL:         event.URL,
+		ClubID:      clubID,
+		SyncTime:    syncTime,
+	}
+	if event.Attending != nil {
+		data.Attending = formatAttending(*event.Attending)
+	}
+
+	// Details is the header of the default description, e.g. "Leader: Sam",
+	// "Difficulty: Beginner", "Distance: 8.0 km" one per line
+	if data.Organizer != "" {
+		data.Details = append(data.Details, "Leader: "+data.Organizer)
+	}
+	if data.SkillLevel != "" {
+		data.Details = append(data.Details, "Difficulty: "+data.SkillLevel)
+	}
+	if data.Terrain != "" {
+		data.Details = append(data.Details, "Terrain: "+data.Terrain)
+	}
+	for _, detail := range formatRouteDetails(event) {
+		if estimate, found := strings.CutPrefix(detail, "Estimated time: "); found {
+			data.EstimatedTime = estimate
+		}
+		data.Details = append(data.Details, detail)
+	}
+	if data.Attending != "" {
+		data.Details = append(data.Details, data.Attending)
+	}
+	if data.Duration != "" {
+		data.Details = append(data.Details, data.Duration)
+	}
+	if len(data.Tags) > 0 {
+		data.Details = append(data.Details, "Tags: "+strings.Join(data.Tags, ", "))
+	}
+	if data.OtherClubs != "" {
+		data.Details = append(data.Details, data.OtherClubs)
+	}
+	return data
+}
@@ -0,0 +1,204 @@
+package stravacal
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// digestDays is how far ahead the email digest looks
+	digestDays = 7
+
+	// defaultSMTPPort is the submission port, used with STARTTLS, when SMTP_PORT is unset
+	defaultSMTPPort = 587
+)
+
+// getSMTPPort returns the mail server port from SMTP_PORT
+func getSMTPPort() (int, error) {
+	value := getenv("SMTP_PORT")
+	if value == "" {
+		return defaultSMTPPort, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("SMTP_PORT must be a port number, got %q", value)
+	}
+	return port, nil
+}
+
+// getDigestRecipients returns the addresses the digest is sent to, from the
+// comma-separated SMTP_TO
+func getDigestRecipients() []string {
+	var recipients []string
+	for _, address := range strings.Split(getenv("SMTP_TO"), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	return recipients
+}
+
+// sendDigest emails the cached events of the next digestDays days, for members
+// who don't use calendars, as plain text with an HTML version formatted like
+// the HTML schedule. Does nothing, with a message saying why, unless SMTP_HOST,
+// SMTP_FROM and SMTP_TO are set
+func sendDigest() error {
+	host := getenv("SMTP_HOST")
+	from := getenv("SMTP_FROM")
+	recipients := getDigestRecipients()
+	if host == "" || from == "" || len(recipients) == 0 {
+		log.Println("Email digest not sent: set SMTP_HOST, SMTP_FROM and SMTP_TO to send it")
+		return nil
+	}
+
+	events, err := loadExistingEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load existing events: %w", err)
+	}
+
+	now := time.Now()
+	until := now.AddDate(0, 0, digestDays)
+	var upcoming []Event
+	for _, event := range events {
+		if event.Start.After(now) && event.Start.Before(until) {
+			upcoming = append(upcoming, event)
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].Start.Before(upcoming[j].Start)
+	})
+
+	if loc, err := time.LoadLocation(getDefaultTimezone()); err == nil {
+		now = now.In(loc)
+	}
+	subject := fmt.Sprintf("%s: the week from %s", getCalendarName(), now.Format("Monday 2 January"))
+	message, err := buildDigestMessage(from, recipients, subject, formatDigestText(upcoming), formatDigestHTML(upcoming), now)
+	if err != nil {
+		return fmt.Errorf("failed to build email digest: %w", err)
+	}
+
+	port := validated().smtpPort
+	var auth smtp.Auth
+	if username := getenv("SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, getenv("SMTP_PASSWORD"), host)
+	}
+	// SendMail upgrades to TLS with STARTTLS whenever the server offers it
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if err := smtp.SendMail(addr, auth, from, recipients, message); err != nil {
+		return fmt.Errorf("failed to send email digest via %s: %w", addr, err)
+	}
+
+	log.Printf("Sent email digest of %d events to %d recipients", len(upcoming), len(recipients))
+	return nil
+}
+
+// formatDigestText renders the digest's plain text body, grouped by local date
+func formatDigestText(events []Event) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("%s - the next %d days\n", getCalendarName(), digestDays))
+	if len(events) == 0 {
+		text.WriteString("\nNo upcoming events.\n")
+	}
+
+	currentDate := ""
+	for _, event := range events {
+		location := eventLocation(event)
+		startLocal := event.Start.In(location)
+
+		if date := startLocal.Format("Monday 2 January"); date != currentDate {
+			text.WriteString(fmt.Sprintf("\n%s\n%s\n", date, strings.Repeat("=", len(date))))
+			currentDate = date
+		}
+
+		when := startLocal.Format("3:04 PM")
+		if isAllDayEvent(event) {
+			when = "All day"
+		}
+		title := event.Title
+		if event.CancelledAt != nil {
+			title += " (Cancelled)"
+		}
+		text.WriteString(fmt.Sprintf("\n%s  %s\n", when, title))
+
+		if metadata := formatEventMetadata(event.SkillLevels, event.Terrain); metadata != "" {
+			text.WriteString(fmt.Sprintf("  %s\n", metadata))
+		}
+		if event.Location != "" {
+			text.WriteString(fmt.Sprintf("  Where: %s\n", event.Location))
+		}
+		if event.Organizer != "" {
+			text.WriteString(fmt.Sprintf("  Leader: %s\n", event.Organizer))
+		}
+		text.WriteString(fmt.Sprintf("  %s\n", event.URL))
+	}
+
+	return text.String()
+}
+
+// formatDigestHTML renders the digest's HTML body with the HTML schedule's layout
+func formatDigestHTML(events []Event) string {
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n")
+	page.WriteString("<html lang=\"en\">\n")
+	page.WriteString("<head>\n")
+	page.WriteString("<meta charset=\"utf-8\">\n")
+	page.WriteString(formatHTMLStyle())
+	page.WriteString("</head>\n")
+	page.WriteString("<body>\n")
+	page.WriteString(fmt.Sprintf("<h1>%s</h1>\n", html.EscapeString(getCalendarName())))
+	page.WriteString(fmt.Sprintf("<p class=\"updated\">The next %d days</p>\n", digestDays))
+	if len(events) == 0 {
+		page.WriteString("<p>No upcoming events.</p>\n")
+	}
+	page.WriteString(formatHTMLEventsByDate(events))
+	page.WriteString("</body>\n")
+	page.WriteString("</html>\n")
+	return page.String()
+}
+
+// buildDigestMessage builds a multipart/alternative email with plain text and
+// HTML versions of the same body
+func buildDigestMessage(from string, to []string, subject, text, htmlBody string, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", htmlBody},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write([]byte(strings.ReplaceAll(part.content, "\n", "\r\n"))); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	message.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(to, ", ")))
+	message.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject)))
+	message.WriteString(fmt.Sprintf("Date: %s\r\n", date.Format(time.RFC1123Z)))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q\r\n", parts.Boundary()))
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
@@ -0,0 +1,113 @@
+package stravacal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// doctorCheck is one connectivity check run by the doctor command
+type doctorCheck struct {
+	name string
+	hint string // What to fix when the check fails
+	run  func(ctx context.Context) error
+}
+
+// runDoctor checks that the Strava credentials and Google Calendar access work,
+// printing a pass or fail line for each check with a hint for failures
+// Nothing is created or changed; Google is skipped without GOOGLE_CALENDAR_ID
+func runDoctor(ctx context.Context) error {
+	var tokens *TokenStore
+	checks := []doctorCheck{
+		{
+			name: "Strava token refresh",
+			hint: "check STRAVA_CLIENT_ID and CLIENT_SECRET, and run \"go run . authorize\" for a new REFRESH_TOKEN",
+			run: func(ctx context.Context) error {
+				var err error
+				if tokens, err = loadTokens(); err != nil {
+					return err
+				}
+				return refreshTokens(ctx, tokens)
+			},
+		},
+		{
+			name: "Strava club events",
+			hint: "check STRAVA_CLUB_ID, and that the athlete who authorized the token is a member of each club",
+			run: func(ctx context.Context) error {
+				if tokens == nil {
+					return fmt.Errorf("skipped, no Strava token")
+				}
+				for _, clubID := range validated().clubIDs {
+					if err := checkClubAccess(ctx, tokens, clubID); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+
+	if calendarID := getenv("GOOGLE_CALENDAR_ID"); calendarID != "" {
+		var srv *CalendarService
+		checks = append(checks,
+			doctorCheck{
+				name: "Google authentication",
+				hint: "check GOOGLE_AUTH_MODE and its credentials (GOOGLE_SERVICE_ACCOUNT or the GOOGLE_OAUTH_ variables)",
+				run: func(ctx context.Context) error {
+					var err error
+					srv, err = getCalendarService()
+					return err
+				},
+			},
+			doctorCheck{
+				name: "Google Calendar access",
+				hint: "check GOOGLE_CALENDAR_ID, and share the calendar with the account above with permission to make changes to events",
+				run: func(ctx context.Context) error {
+					if srv == nil {
+						return fmt.Errorf("skipped, not authenticated")
+					}
+					return checkCalendarAccess(ctx, srv, calendarID)
+				},
+			},
+		)
+	}
+
+	var failed []error
+	for _, check := range checks {
+		if err := check.run(ctx); err != nil {
+			fmt.Printf("✗ %s: %v\n    Fix: %s\n", check.name, err, check.hint)
+			failed = append(failed, fmt.Errorf("%s: %w", check.name, err))
+			continue
+		}
+		fmt.Printf("✓ %s\n", check.name)
+	}
+	if getenv("GOOGLE_CALENDAR_ID") == "" {
+		fmt.Println("- Google Calendar not checked (GOOGLE_CALENDAR_ID not set)")
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d checks failed: %w", len(failed), len(checks), errors.Join(failed...))
+	}
+	fmt.Println("\nAll checks passed")
+	return nil
+}
+
+// checkClubAccess fetches a single upcoming event of a club, which fails when
+// the club doesn't exist or the athlete isn't a member
+func checkClubAccess(ctx context.Context, tokens *TokenStore, clubID string) error {
+	url := fmt.Sprintf("%s/clubs/%s/group_events?page=1&per_page=1&upcoming=true", stravaAPIBase, clubID)
+	resp, err := makeAPIRequest(ctx, tokens, url)
+	if err != nil {
+		return fmt.Errorf("club %s: %w", clubID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("club %s: API request failed with status %d: %s", clubID, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
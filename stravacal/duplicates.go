@@ -0,0 +1,98 @@
+package stravacal
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// getMergeClubDuplicates reports whether the same run posted to several clubs
+// is merged into one event, from MERGE_CLUB_DUPLICATES (default false)
+func getMergeClubDuplicates() (bool, error) {
+	value := getenv("MERGE_CLUB_DUPLICATES")
+	if value == "" {
+		return false, nil
+	}
+	merge, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("MERGE_CLUB_DUPLICATES must be true or false, got %q", value)
+	}
+	return merge, nil
+}
+
+// eventSignature identifies an occurrence by its start, title and location,
+// ignoring case and spacing, so copies posted to different clubs match
+func eventSignature(event Event) string {
+	normalize := func(s string) string {
+		return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	}
+	return fmt.Sprintf("%d|%s|%s", event.Start.Unix(), normalize(event.Title), normalize(event.Location))
+}
+
+// mergeClubDuplicates merges occurrences from different clubs with the same
+// eventSignature into one, recording the others in its Duplicates. The one
+// with the lowest Strava event ID is kept, so the same event survives every
+// run. Occurrences from the same club are never merged
+func mergeClubDuplicates(events []Event) []Event {
+	groups := make(map[string][]Event)
+	var signatures []string
+	for _, event := range events {
+		signature := eventSignature(event)
+		if _, seen := groups[signature]; !seen {
+			signatures = append(signatures, signature)
+		}
+		groups[signature] = append(groups[signature], event)
+	}
+
+	var merged []Event
+	for _, signature := range signatures {
+		group := groups[signature]
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].ID != group[j].ID {
+				return group[i].ID < group[j].ID
+			}
+			return group[i].ClubID < group[j].ClubID
+		})
+
+		canonical := group[0]
+		for _, event := range group[1:] {
+			if event.ClubID == canonical.ClubID {
+				merged = append(merged, event)
+				continue
+			}
+			canonical.Duplicates = append(canonical.Duplicates, DuplicateEvent{ID: event.ID, ClubID: event.ClubID, URL: event.URL})
+			slog.Info("Merged event posted to several clubs", "event_id", canonical.ID, "club_id", canonical.ClubID,
+				"duplicate_id", event.ID, "duplicate_club_id", event.ClubID, "title", canonical.Title)
+		}
+		merged = append(merged, canonical)
+	}
+	return merged
+}
+
+// duplicateUIDs returns the UIDs the copies merged into an event would have
+// had, which share its start
+func duplicateUIDs(event Event) []string {
+	var uids []string
+	for _, duplicate := range event.Duplicates {
+		uids = append(uids, eventUID(Event{ID: duplicate.ID, Start: event.Start}))
+	}
+	return uids
+}
+
+// formatDuplicateClubs returns the description line naming the other clubs an
+// event was posted to, e.g. "Also posted to Strava Club 456", or ""
+func formatDuplicateClubs(event Event) string {
+	var clubs []string
+	for _, duplicate := range event.Duplicates {
+		if !slices.Contains(clubs, duplicate.ClubID) {
+			clubs = append(clubs, duplicate.ClubID)
+		}
+	}
+	if len(clubs) == 0 {
+		return ""
+	}
+	return "Also posted to Strava Club " + strings.Join(clubs, ", ")
+}
@@ -0,0 +1,194 @@
+package stravacal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// explainTimeLayout is how occurrence start times are shown by the explain command
+const explainTimeLayout = "Mon 2 Jan 2006 3:04 PM MST"
+
+// parseExplainArgs returns the Strava event ID given to the explain command
+func parseExplainArgs(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("usage: explain <strava event ID>")
+	}
+	eventID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || eventID <= 0 {
+		return 0, fmt.Errorf("event ID must be a positive integer, got %q", args[0])
+	}
+	return eventID, nil
+}
+
+// explainEvent prints why the next sync would create, update, delete or leave
+// alone each occurrence of one Strava event, by comparing:
+// - the cached occurrences, with the reason any would be left out
+// - the occurrences in a fresh fetch from Strava
+// - the matching Google Calendar events, field by field
+// Nothing is changed or saved
+func explainEvent(ctx context.Context, eventID int64, windowDays int, clubID string) error {
+	now := time.Now()
+
+	// Cache, read directly so occurrences the filters leave out can be explained
+	store, err := openEventStore()
+	if err != nil {
+		return err
+	}
+	stored, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load existing events: %w", err)
+	}
+	var cached []Event
+	for _, event := range stored {
+		if event.ID == eventID {
+			cached = append(cached, event)
+		}
+	}
+
+	fmt.Printf("Strava event %d\n\n", eventID)
+	fmt.Printf("Cache (%s):\n", eventStorePath())
+	if len(cached) == 0 {
+		fmt.Println("  not in the cache")
+	}
+	for _, event := range cached {
+		fmt.Printf("  %s  %s\n", formatExplainStart(event), event.Title)
+		switch {
+		case event.CancelledAt != nil:
+			fmt.Printf("    cancelled %s, missing from Strava since %s\n", event.CancelledAt.Format(explainTimeLayout), formatMissingSince(event))
+		case event.MissingSince != nil:
+			fmt.Printf("    missing from Strava since %s (%d runs)\n", formatMissingSince(event), event.MissingRuns)
+		}
+		if reason := exclusionReason(event); reason != "" {
+			fmt.Printf("    left out: %s\n", reason)
+		}
+	}
+
+	// Fresh fetch, converted the same way as a sync but without the filters
+	tokens, err := loadTokens()
+	if err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+	clubIDs := validated().clubIDs
+	log.Println("Fetching club events from Strava API...")
+	clubEvents, err := fetchClubsEvents(ctx, tokens, clubIDs, true)
+	if clubEvents == nil {
+		return fmt.Errorf("failed to fetch events from API: %w", err)
+	} else if err != nil {
+		fmt.Printf("\nWarning: %v\n", err)
+	}
+
+	var fresh []Event
+	since := filterSince(now)
+	fmt.Println("\nStrava:")
+	for _, id := range clubIDs {
+		for _, se := range clubEvents[id] {
+			if se.ID != eventID {
+				continue
+			}
+			occurrences, err := convertStravaEvent(se, id)
+			if err != nil {
+				fmt.Printf("  club %s: can't be converted: %v\n", id, err)
+				continue
+			}
+			for _, event := range occurrences {
+				fmt.Printf("  %s  %s (club %s)\n", formatExplainStart(event), event.Title, id)
+				if reason := exclusionReason(event); reason != "" {
+					fmt.Printf("    left out: %s\n", reason)
+				} else if !event.Start.After(since) {
+					fmt.Println("    left out: started before FILTER_SINCE_DAYS")
+				} else {
+					fresh = append(fresh, event)
+				}
+			}
+		}
+	}
+	if len(fresh) == 0 {
+		fmt.Println("  no occurrences in the fetch (deleted, no longer upcoming, or left out above)")
+	}
+
+	// What the sync would pass to the calendar: fresh occurrences, plus cached
+	// ones within the DELETE_GRACE_RUNS grace period or recently cancelled
+	synced := mergeCachedEvents(fresh, cached, now)
+
+	calendarID := getenv("GOOGLE_CALENDAR_ID")
+	if calendarID == "" {
+		fmt.Println("\nGoogle Calendar: GOOGLE_CALENDAR_ID not set, skipped")
+		return nil
+	}
+
+	log.Println("Authenticating with Google Calendar...")
+	srv, err := getCalendarService()
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with Google Calendar: %w", err)
+	}
+	existing, err := listCalendarEvents(ctx, srv, calendarID, filterSince(now), now.AddDate(0, 0, windowDays+30))
+	if err != nil {
+		return fmt.Errorf("unable to retrieve existing calendar events: %w", err)
+	}
+	calendarEvents := make(map[string]*calendar.Event)
+	for _, gcalEvent := range existing {
+		calendarEvents[gcalEvent.ICalUID] = gcalEvent
+	}
+
+	fmt.Printf("\nGoogle Calendar (%s):\n", calendarID)
+	explained := make(map[string]bool)
+	for _, event := range synced {
+		uid := eventUID(event)
+		explained[uid] = true
+		gcalEvent := calendarEvents[uid]
+
+		fmt.Printf("  %s  %s\n", formatExplainStart(event), uid)
+		switch {
+		case event.CancelledAt != nil && gcalEvent != nil:
+			fmt.Println("    would delete: cancelled on Strava")
+		case event.CancelledAt != nil:
+			fmt.Println("    nothing to do: cancelled on Strava and not in the calendar")
+		case gcalEvent == nil:
+			fmt.Println("    would create: not in the calendar")
+		default:
+			changes := calendarEventChanges(gcalEvent, event, clubID, now.Format("Mon, 2 Jan @ 3:04 PM"))
+			if len(changes) == 0 {
+				fmt.Println("    up to date")
+			} else {
+				fmt.Println("    would update:")
+				for _, change := range changes {
+					fmt.Printf("      %s\n", change)
+				}
+			}
+		}
+	}
+
+	// Calendar events for this Strava event that the sync no longer knows about,
+	// including the older <id>@strava.com UIDs
+	for _, gcalEvent := range existing {
+		uid := gcalEvent.ICalUID
+		if explained[uid] {
+			continue
+		}
+		var id int64
+		if _, err := fmt.Sscanf(uid, "%d", &id); err != nil || id != eventID {
+			continue
+		}
+		fmt.Printf("  %s  %s\n", gcalEvent.Start.DateTime+gcalEvent.Start.Date, uid)
+		fmt.Println("    would delete: no longer on Strava or left out by the filters")
+	}
+	return nil
+}
+
+// formatExplainStart returns an occurrence's start in its own timezone
+func formatExplainStart(event Event) string {
+	return event.Start.In(eventLocation(event)).Format(explainTimeLayout)
+}
+
+// formatMissingSince returns when an event was first missing from Strava, if known
+func formatMissingSince(event Event) string {
+	if event.MissingSince == nil {
+		return "an earlier run"
+	}
+	return event.MissingSince.Format(explainTimeLayout)
+}
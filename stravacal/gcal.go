@@ -0,0 +1,904 @@
+package stravacal
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// Retry policy for transient Google Calendar API errors on individual event changes
+const (
+	maxCalendarRetries     = 4
+	calendarRetryBaseDelay = 1 * time.Second
+)
+
+// stravaSyncMarker separates notes added by hand in Google Calendar (above)
+// from the description maintained by the sync (below)
+const stravaSyncMarker = "--- Strava Sync (do not edit below) ---"
+
+// Google Calendar's limits on reminder overrides: at most 5, up to 4 weeks before
+const (
+	maxReminderOverrides = 5
+	maxReminderMinutes   = 40320
+)
+
+// getGoogleAuthMode returns how to authenticate with Google Calendar, from GOOGLE_AUTH_MODE:
+// - "service_account" (default): a service account the calendar is shared with
+// - "oauth": your own Google account via an OAuth client and refresh token
+func getGoogleAuthMode() (string, error) {
+	mode := strings.ToLower(getenv("GOOGLE_AUTH_MODE"))
+	switch mode {
+	case "":
+		return "service_account", nil
+	case "service_account", "oauth":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("GOOGLE_AUTH_MODE must be service_account or oauth, got %q", mode)
+	}
+}
+
+// getCalendarService creates and returns an authenticated Google Calendar service
+// using the credentials for the configured GOOGLE_AUTH_MODE
+func getCalendarService() (*CalendarService, error) {
+	// The OAuth transports are built on the shared client, so token requests and
+	// calendar requests reuse its connections
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient())
+
+	mode, err := getGoogleAuthMode()
+	if err != nil {
+		return nil, err
+	}
+
+	var client *http.Client
+	account := "Google account"
+	if mode == "oauth" {
+		client, err = oauthUserClient(ctx)
+	} else {
+		var email string
+		client, email, err = serviceAccountClient(ctx)
+		account = "service account " + email
+	}
+	if err != nil {
+		return nil, fmt.Errorf("google auth mode %s: %w", mode, err)
+	}
+	client.Timeout = httpClient().Timeout
+
+	// Create calendar service, keeping the HTTP client for batch requests
+	srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create calendar service: %w", err)
+	}
+
+	return &CalendarService{Service: srv, httpClient: client, account: account}, nil
+}
+
+// checkCalendarAccess makes a cheap request to calendarID before any changes, so a
+// calendar that wasn't shared with the account fails once with a clear message
+// rather than with an error for every event
+func checkCalendarAccess(ctx context.Context, srv *CalendarService, calendarID string) error {
+	now := time.Now()
+	err := withCalendarRetry(ctx, "check calendar access", func() error {
+		_, err := srv.Events.List(calendarID).
+			Context(ctx).
+			TimeMin(now.Format(time.RFC3339)).
+			TimeMax(now.Add(time.Minute).Format(time.RFC3339)).
+			MaxResults(1).
+			Do()
+		return err
+	})
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && (apiErr.Code == http.StatusForbidden || apiErr.Code == http.StatusNotFound) {
+		return fmt.Errorf("%s cannot access calendar %s; did you share it with write permission? (%w)", srv.account, calendarID, err)
+	} else if err != nil {
+		return err
+	}
+
+	// Reading events doesn't prove we can write them. The access role is only
+	// known for calendars in the account's calendar list, which a calendar shared
+	// with a service account often isn't, so a failed lookup is ignored
+	entry, err := srv.CalendarList.Get(calendarID).Context(ctx).Do()
+	if err != nil {
+		slog.Debug("Could not look up calendar access role", "calendar_id", calendarID, "error", err)
+		return nil
+	}
+	if entry.AccessRole != "owner" && entry.AccessRole != "writer" {
+		return fmt.Errorf("%s can only read calendar %s (access role %s); did you share it with write permission?", srv.account, calendarID, entry.AccessRole)
+	}
+	return nil
+}
+
+// oauthUserClient returns an HTTP client authorized as a Google user from:
+// - GOOGLE_OAUTH_CLIENT_ID and GOOGLE_OAUTH_CLIENT_SECRET: OAuth client credentials
+// - GOOGLE_OAUTH_REFRESH_TOKEN: Refresh token granted for the calendar scope
+func oauthUserClient(ctx context.Context) (*http.Client, error) {
+	clientID := getenv("GOOGLE_OAUTH_CLIENT_ID")
+	clientSecret := getenv("GOOGLE_OAUTH_CLIENT_SECRET")
+	refreshToken := getenv("GOOGLE_OAUTH_REFRESH_TOKEN")
+
+	var missing []string
+	for name, value := range map[string]string{
+		"GOOGLE_OAUTH_CLIENT_ID":     clientID,
+		"GOOGLE_OAUTH_CLIENT_SECRET": clientSecret,
+		"GOOGLE_OAUTH_REFRESH_TOKEN": refreshToken,
+	} {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing required environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	log.Println("Using Google OAuth user credentials")
+	config := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     google.Endpoint,
+		Scopes:       []string{calendar.CalendarScope},
+	}
+	return config.Client(ctx, &oauth2.Token{RefreshToken: refreshToken}), nil
+}
+
+// serviceAccountClient returns an HTTP client authorized as a service account,
+// and the account's email, using the JSON key from either:
+// 1. GOOGLE_SERVICE_ACCOUNT environment variable (for CI/CD), or the file named by GOOGLE_SERVICE_ACCOUNT_FILE
+// 2. service-account.json file (for local development)
+func serviceAccountClient(ctx context.Context) (*http.Client, string, error) {
+	var serviceAccountKey []byte
+
+	// Try to get service account key from environment variable first (for CI/CD)
+	serviceAccountEnv, err := getSecret("GOOGLE_SERVICE_ACCOUNT")
+	if err != nil {
+		return nil, "", err
+	}
+	if serviceAccountEnv != "" {
+		serviceAccountKey, err = decodeServiceAccountKey(serviceAccountEnv)
+		if err != nil {
+			return nil, "", err
+		}
+		log.Println("Using service account from GOOGLE_SERVICE_ACCOUNT environment variable")
+	} else {
+		// Fall back to reading from file (for local development)
+		serviceAccountKey, err = os.ReadFile("service-account.json")
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read service account key (tried GOOGLE_SERVICE_ACCOUNT env var and service-account.json file): %w", err)
+		}
+		log.Println("Using service account from service-account.json file")
+	}
+
+	// Create credentials from service account key
+	config, err := google.JWTConfigFromJSON(serviceAccountKey, calendar.CalendarScope)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to parse service account key: %w", err)
+	}
+
+	return config.Client(ctx), config.Email, nil
+}
+
+// decodeServiceAccountKey returns the JSON key in GOOGLE_SERVICE_ACCOUNT, which
+// may be the JSON itself or base64-encoded, as GitHub secrets often are
+func decodeServiceAccountKey(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if json.Valid([]byte(value)) {
+		return []byte(value), nil
+	}
+
+	// Encoders wrap long output and may use the URL-safe alphabet or no padding
+	encoded := strings.Join(strings.Fields(value), "")
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		decoded, err := encoding.DecodeString(encoded)
+		if err == nil && json.Valid(decoded) {
+			return decoded, nil
+		}
+	}
+	return nil, fmt.Errorf("GOOGLE_SERVICE_ACCOUNT must be a JSON key or a base64-encoded JSON key")
+}
+
+// syncStravaEvents synchronizes Strava events with Google Calendar
+// - Creates new events that don't exist
+// - Updates existing events that have changed
+// - Deletes events that no longer exist on Strava
+// Changes are sent to Google in batches to save API quota. When dryRun is true
+// the changes are only logged, along with the fields that triggered each update
+// Progress is checkpointed after each batch, so a sync that is interrupted or
+// hits a temporary failure is resumed by the next run rather than rewriting
+// every event
+// The returned report is set whenever the diff completed, even if some changes failed
+func syncStravaEvents(ctx context.Context, events []Event, srv *CalendarService, calendarID string, clubID string, windowDays int, dryRun bool) (*SyncReport, error) {
+	// Get current time for sync timestamp in the default timezone
+	now := time.Now()
+	if loc, err := time.LoadLocation(getDefaultTimezone()); err == nil {
+		now = now.In(loc)
+	}
+	syncTime := now.Format("Mon, 2 Jan @ 3:04 PM")
+
+	// Resuming an unfinished sync keeps its sync time, so the events it already
+	// wrote compare as up to date and only the remaining changes are made
+	var checkpoint *syncCheckpoint
+	if !dryRun {
+		checkpoint = startCheckpoint(calendarID, syncTime, now)
+		syncTime = checkpoint.SyncTime
+	}
+
+	// Manual events can only be adopted when enabled, since it rewrites events
+	// this tool didn't create
+	adoptManual := validated().adoptManual
+
+	sink := &GoogleCalendarSink{
+		srv:         srv,
+		calendarID:  calendarID,
+		clubID:      clubID,
+		syncTime:    syncTime,
+		windowDays:  windowDays,
+		adoptManual: adoptManual,
+	}
+	report, err := syncSink(ctx, sink, events, dryRun, checkpoint)
+
+	// A sync stopped by a temporary failure keeps the checkpoint so the next run
+	// resumes it; one that failed for good starts afresh
+	if checkpoint != nil && !resumableSyncError(err) {
+		checkpoint.finish()
+	}
+	return report, err
+}
+
+// GoogleCalendarSink is a Google Calendar as a CalendarSink. Changes are
+// queued and sent in batches by Flush, and events created by hand can be
+// adopted (see ADOPT_MANUAL_EVENTS)
+type GoogleCalendarSink struct {
+	srv         *CalendarService
+	calendarID  string
+	clubID      string
+	syncTime    string // Shown in descriptions, kept when resuming a checkpoint
+	windowDays  int
+	adoptManual bool
+
+	manualEvents []*calendar.Event // Events not created by this tool, set by ListManaged
+	operations   []calendarOperation
+}
+
+// Name returns the calendar ID
+func (g *GoogleCalendarSink) Name() string {
+	return g.calendarID
+}
+
+// ListManaged returns the events this tool created, tagged with the Strava
+// event or with an iCalUID ending in @strava.com, from FILTER_SINCE_DAYS ago to
+// 30 days past the sync window, so events that drift beyond the window edge
+// can still be found and deleted. This includes the older <id>@strava.com
+// format, which is deleted as no longer on Strava
+func (g *GoogleCalendarSink) ListManaged(ctx context.Context) ([]sinkEvent, error) {
+	timeMin := filterSince(time.Now())
+	timeMax := time.Now().AddDate(0, 0, g.windowDays+30)
+
+	existingEvents, err := listCalendarEvents(ctx, g.srv, g.calendarID, timeMin, timeMax)
+	if err != nil {
+		return nil, err
+	}
+
+	var managed []sinkEvent
+	g.manualEvents = nil
+	for _, gcalEvent := range existingEvents {
+		uid, ok := managedEventUID(gcalEvent)
+		if !ok {
+			g.manualEvents = append(g.manualEvents, gcalEvent)
+			continue
+		}
+		managed = append(managed, sinkEvent{UID: uid, Title: gcalEvent.Summary, Href: gcalEvent.Id, ETag: gcalEvent.Etag, Native: gcalEvent})
+	}
+	return managed, nil
+}
+
+// Changes compares every field the sync writes (see calendarEventChanges)
+func (g *GoogleCalendarSink) Changes(existing sinkEvent, event Event) []string {
+	return calendarEventChanges(existing.Native.(*calendar.Event), event, g.clubID, g.syncTime)
+}
+
+// Create queues importing the event (Import handles iCalUID-based creates)
+func (g *GoogleCalendarSink) Create(ctx context.Context, event Event) error {
+	startLocal := event.Start.In(eventLocation(event))
+	g.operations = append(g.operations, newCreateOperation(g.calendarID, createGoogleCalendarEvent(event, g.clubID, g.syncTime),
+		"event_id", event.ID, "uid", eventUID(event), "title", event.Title, "start", startLocal.Format("Mon 2 Jan")))
+	return nil
+}
+
+// Update queues rewriting an event, keeping any notes added by hand above the
+// sync marker
+func (g *GoogleCalendarSink) Update(ctx context.Context, existing sinkEvent, event Event) error {
+	humanNotes, _ := splitManagedDescription(existing.Native.(*calendar.Event).Description)
+	updatedEvent := createGoogleCalendarEvent(event, g.clubID, g.syncTime)
+	updatedEvent.Description = joinManagedDescription(humanNotes, buildGoogleEventDescription(event, g.clubID, g.syncTime))
+	startLocal := event.Start.In(eventLocation(event))
+	g.operations = append(g.operations, newUpdateOperation(g.calendarID, existing.Href, updatedEvent,
+		"event_id", event.ID, "uid", existing.UID, "title", event.Title, "start", startLocal.Format("Mon 2 Jan")))
+	return nil
+}
+
+// Delete queues deleting an event
+func (g *GoogleCalendarSink) Delete(ctx context.Context, existing sinkEvent) error {
+	g.operations = append(g.operations, newDeleteOperation(g.calendarID, existing.Native.(*calendar.Event),
+		"uid", existing.UID, "title", existing.Title))
+	return nil
+}
+
+// FindManual returns a manually created event matching event, when adopting
+// them is enabled
+func (g *GoogleCalendarSink) FindManual(event Event) *sinkEvent {
+	if !g.adoptManual {
+		return nil
+	}
+	match := findManualEvent(g.manualEvents, event)
+	if match == nil {
+		return nil
+	}
+	return &sinkEvent{UID: eventUID(event), Title: match.Summary, Href: match.Id, ETag: match.Etag, Native: match}
+}
+
+// Adopt queues rewriting a manually created event as the occurrence, keeping
+// its description as notes above the sync marker
+func (g *GoogleCalendarSink) Adopt(ctx context.Context, manual sinkEvent, event Event) error {
+	adoptedEvent := createGoogleCalendarEvent(event, g.clubID, g.syncTime)
+	_, managedDesc := splitManagedDescription(adoptedEvent.Description)
+	adoptedEvent.Description = joinManagedDescription(strings.TrimSpace(manual.Native.(*calendar.Event).Description), managedDesc)
+	op := newUpdateOperation(g.calendarID, manual.Href, adoptedEvent,
+		"event_id", event.ID, "uid", eventUID(event), "title", event.Title, "previous_title", manual.Title)
+	op.action = "adopt"
+	op.success = "Adopted manually created event"
+	g.operations = append(g.operations, op)
+	return nil
+}
+
+// Flush sends the queued changes in batches, returning the error of each in
+// the order they were queued
+func (g *GoogleCalendarSink) Flush(ctx context.Context, onBatch func(done []int)) []error {
+	errs := executeCalendarOperations(ctx, g.srv, g.operations, onBatch)
+	g.operations = nil
+	return errs
+}
+
+// calendarEventChanges compares a Google Calendar event with the Strava occurrence
+// it was created from and describes each field that differs, e.g.
+// "title \"Old\" -> \"New\"". No changes means the event is up to date
+func calendarEventChanges(gcalEvent *calendar.Event, stravaEvent Event, clubID string, syncTime string) []string {
+	var changes []string
+
+	expectedTitle := calendarEventTitle(stravaEvent)
+	if gcalEvent.Summary != expectedTitle {
+		changes = append(changes, fmt.Sprintf("title %q -> %q", gcalEvent.Summary, expectedTitle))
+	}
+
+	// Events created before they were tagged get their properties once
+	var properties map[string]string
+	if gcalEvent.ExtendedProperties != nil {
+		properties = gcalEvent.ExtendedProperties.Private
+	}
+	expectedProperties := eventProperties(stravaEvent, clubID)
+	for _, key := range slices.Sorted(maps.Keys(expectedProperties)) {
+		if properties[key] != expectedProperties[key] {
+			changes = append(changes, fmt.Sprintf("properties %s %q -> %q", key, properties[key], expectedProperties[key]))
+		}
+	}
+
+	// Convert times to the event's timezone for comparison
+	location := eventLocation(stravaEvent)
+	stravaStartLocal := stravaEvent.Start.In(location)
+
+	if isAllDayEvent(stravaEvent) {
+		// All-day events only have dates, so compare those rather than times
+		// (an event that had a time has no Date and is updated once)
+		expectedStart, expectedEnd := calendarEventTimes(stravaEvent)
+		if gcalEvent.Start.Date != expectedStart.Date {
+			changes = append(changes, fmt.Sprintf("start %s%s -> %s", gcalEvent.Start.Date, gcalEvent.Start.DateTime, expectedStart.Date))
+		}
+		if gcalEvent.End.Date != expectedEnd.Date {
+			changes = append(changes, fmt.Sprintf("end %s%s -> %s", gcalEvent.End.Date, gcalEvent.End.DateTime, expectedEnd.Date))
+		}
+	} else {
+		// An all-day event has no DateTime, so it fails to parse and is updated
+		stravaEnd := publishedEnd(stravaEvent)
+		stravaEndLocal := stravaEnd.In(location)
+
+		if !sameCalendarTime(gcalEvent.Start.DateTime, stravaEvent.Start) {
+			changes = append(changes, fmt.Sprintf("start %s -> %s", gcalEvent.Start.DateTime, stravaStartLocal.Format(time.RFC3339)))
+		}
+		if !sameCalendarTime(gcalEvent.End.DateTime, stravaEnd) {
+			changes = append(changes, fmt.Sprintf("end %s -> %s", gcalEvent.End.DateTime, stravaEndLocal.Format(time.RFC3339)))
+		}
+
+		if gcalEvent.Start.TimeZone != eventZone(stravaEvent) {
+			changes = append(changes, fmt.Sprintf("timezone %q -> %q", gcalEvent.Start.TimeZone, eventZone(stravaEvent)))
+		}
+	}
+
+	// Google leaves transparency out for the default, opaque
+	expectedStatus, expectedTransparency := calendarEventStatus(stravaEvent)
+	if gcalEvent.Status != expectedStatus {
+		changes = append(changes, fmt.Sprintf("status %q -> %q", gcalEvent.Status, expectedStatus))
+	}
+	if transparency := cmp.Or(gcalEvent.Transparency, "opaque"); transparency != expectedTransparency {
+		changes = append(changes, fmt.Sprintf("transparency %q -> %q", transparency, expectedTransparency))
+	}
+
+	// Google returns no visibility for the default
+	if visibility, expected := cmp.Or(gcalEvent.Visibility, "default"), cmp.Or(eventVisibility(stravaEvent), "default"); visibility != expected {
+		changes = append(changes, fmt.Sprintf("visibility %q -> %q", visibility, expected))
+	}
+
+	if expectedColor := getTerrainColorID(stravaEvent.Terrain); gcalEvent.ColorId != expectedColor {
+		changes = append(changes, fmt.Sprintf("color %q -> %q", gcalEvent.ColorId, expectedColor))
+	}
+
+	expectedReminders := validated().reminders
+	if formatReminders(gcalEvent.Reminders) != formatReminders(expectedReminders) {
+		changes = append(changes, fmt.Sprintf("reminders %q -> %q", formatReminders(gcalEvent.Reminders), formatReminders(expectedReminders)))
+	}
+
+	// Check if description has changed
+	newDesc := buildGoogleEventDescription(stravaEvent, clubID, syncTime)
+
+	// Only the Strava-managed part of the description is compared, so notes
+	// added by hand above the sync marker never trigger an update
+	// The attendee count is left out too, so people joining don't cause an
+	// update every run; the current count is written with any other change
+	_, managedDesc := splitManagedDescription(gcalEvent.Description)
+	if withoutAttending(managedDesc) != withoutAttending(strings.TrimSpace(newDesc)) {
+		changes = append(changes, "description "+describeTextChange(managedDesc, strings.TrimSpace(newDesc)))
+	}
+
+	return changes
+}
+
+// changedFields names the fields behind an update's changes, e.g. "time" for a
+// start, end or timezone change and "status" for a transparency change, in the
+// order they were found
+func changedFields(changes []string) []string {
+	var fields []string
+	for _, change := range changes {
+		field, _, _ := strings.Cut(change, " ")
+		switch field {
+		case "start", "end", "timezone":
+			field = "time"
+		case "transparency":
+			field = "status"
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// tallySyncReport counts the report's events by outcome
+func tallySyncReport(report *SyncReport) {
+	for _, outcome := range report.Events {
+		switch {
+		case outcome.Error != "":
+			report.Failed++
+		case outcome.Action == "create":
+			report.Created++
+		case outcome.Action == "update", outcome.Action == "adopt":
+			report.Updated++
+		case outcome.Action == "delete":
+			report.Deleted++
+		case outcome.Action == "skip":
+			report.Skipped++
+		}
+	}
+}
+
+// printSyncSummary prints a summary of a sync for manual runs, e.g.
+// "3 created, 1 updated (time changed), 2 deleted", then one line per change
+// unless the log level is above INFO
+func printSyncSummary(report *SyncReport) {
+	var updatedFields []string
+	for _, outcome := range report.Events {
+		for _, field := range outcome.Changes {
+			if !slices.Contains(updatedFields, field) {
+				updatedFields = append(updatedFields, field)
+			}
+		}
+	}
+	updated := fmt.Sprintf("%d updated", report.Updated)
+	if len(updatedFields) > 0 {
+		updated += fmt.Sprintf(" (%s changed)", strings.Join(updatedFields, ", "))
+	}
+
+	title := "Sync summary for " + report.CalendarID
+	if report.DryRun {
+		title = "Dry run summary for " + report.CalendarID + " (nothing was changed)"
+	}
+	fmt.Println()
+	fmt.Printf("%s: %d created, %s, %d deleted, %d unchanged, %d failed\n",
+		title, report.Created, updated, report.Deleted, report.Skipped, report.Failed)
+
+	// Quiet runs (--quiet, or LOG_LEVEL above INFO) only print the totals
+	if logLevel > slog.LevelInfo {
+		return
+	}
+
+	symbols := map[string]string{"create": "+", "update": "~", "adopt": "~", "delete": "-"}
+	for _, outcome := range report.Events {
+		symbol, ok := symbols[outcome.Action]
+		if !ok {
+			continue
+		}
+		line := fmt.Sprintf("  %s %-7s %s", symbol, outcome.Action, outcome.Title)
+		if len(outcome.Changes) > 0 {
+			line += fmt.Sprintf(" (%s)", strings.Join(outcome.Changes, ", "))
+		}
+		if outcome.Error != "" {
+			line = fmt.Sprintf("  ✗ %-7s %s: %s", outcome.Action, outcome.Title, outcome.Error)
+		}
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
+
+// getAdoptManualEvents reports whether manually created calendar events matching a
+// Strava event are adopted rather than duplicated, from ADOPT_MANUAL_EVENTS (default false)
+func getAdoptManualEvents() (bool, error) {
+	value := getenv("ADOPT_MANUAL_EVENTS")
+	if value == "" {
+		return false, nil
+	}
+	adopt, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("ADOPT_MANUAL_EVENTS must be true or false, got %q", value)
+	}
+	return adopt, nil
+}
+
+// findManualEvent returns the first manually created event that starts at the
+// same time as the Strava event and has a similar title, removing it from
+// candidates so it is adopted at most once. Returns nil if none match
+func findManualEvent(candidates []*calendar.Event, event Event) *calendar.Event {
+	for i, candidate := range candidates {
+		if candidate == nil || candidate.Start == nil {
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, candidate.Start.DateTime)
+		if err != nil || !start.Equal(event.Start) {
+			continue
+		}
+		if similarTitles(candidate.Summary, event.Title) {
+			candidates[i] = nil
+			return candidate
+		}
+	}
+	return nil
+}
+
+// similarTitles reports whether two titles match once case, punctuation and
+// spacing are ignored, or one contains the other (e.g. "Tuesday Run" and
+// "Tuesday Run | Beginner")
+func similarTitles(a, b string) bool {
+	normalize := func(s string) string {
+		return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}), " ")
+	}
+	a, b = normalize(a), normalize(b)
+	if a == "" || b == "" {
+		return false
+	}
+	return strings.Contains(a, b) || strings.Contains(b, a)
+}
+
+// getTerrainColors parses TERRAIN_COLORS, which maps terrain codes to Google
+// Calendar color IDs, e.g. "0=9,1=10,2=5" for blue road, green trail and
+// yellow mixed runs. Returns an empty map when unset
+func getTerrainColors() (map[int]string, error) {
+	colors := make(map[int]string)
+	value := getenv("TERRAIN_COLORS")
+	if value == "" {
+		return colors, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		terrain, colorID, found := strings.Cut(pair, "=")
+		code, err := strconv.Atoi(strings.TrimSpace(terrain))
+		if !found || err != nil || getTerrainString(&code) == "" {
+			return nil, fmt.Errorf("TERRAIN_COLORS entry %q must be <terrain 0-2>=<color ID 1-11>", pair)
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(colorID))
+		if err != nil || id < 1 || id > 11 {
+			return nil, fmt.Errorf("TERRAIN_COLORS entry %q must be <terrain 0-2>=<color ID 1-11>", pair)
+		}
+		colors[code] = strconv.Itoa(id)
+	}
+	return colors, nil
+}
+
+// getTerrainColorID returns the Google Calendar color ID for a terrain, or ""
+// to keep the calendar's default color
+func getTerrainColorID(terrain *int) string {
+	if terrain == nil {
+		return ""
+	}
+	return validated().terrainColors[*terrain]
+}
+
+// getEventReminders parses EVENT_REMINDERS, a list of reminder overrides as
+// <method>=<minutes before>, e.g. "popup=60,email=1440" for a popup an hour
+// before and an email a day before. Returns nil when unset, so events use the
+// calendar's default reminders
+func getEventReminders() (*calendar.EventReminders, error) {
+	value := getenv("EVENT_REMINDERS")
+	if value == "" {
+		return nil, nil
+	}
+
+	reminders := &calendar.EventReminders{
+		UseDefault: false,
+		// UseDefault is omitted from the request when false unless forced
+		ForceSendFields: []string{"UseDefault"},
+	}
+	for _, pair := range strings.Split(value, ",") {
+		method, minutes, found := strings.Cut(pair, "=")
+		method = strings.ToLower(strings.TrimSpace(method))
+		m, err := strconv.Atoi(strings.TrimSpace(minutes))
+		if !found || (method != "popup" && method != "email") || err != nil || m < 0 || m > maxReminderMinutes {
+			return nil, fmt.Errorf("EVENT_REMINDERS entry %q must be <popup|email>=<minutes 0-%d>", pair, maxReminderMinutes)
+		}
+		reminders.Overrides = append(reminders.Overrides, &calendar.EventReminder{
+			Method:  method,
+			Minutes: int64(m),
+			// Minutes is omitted from the request when 0 unless forced
+			ForceSendFields: []string{"Minutes"},
+		})
+	}
+	if len(reminders.Overrides) > maxReminderOverrides {
+		return nil, fmt.Errorf("EVENT_REMINDERS can have at most %d reminders, got %d", maxReminderOverrides, len(reminders.Overrides))
+	}
+	return reminders, nil
+}
+
+// formatReminders describes an event's reminders for comparison, e.g.
+// "email:1440,popup:60", or "" when the calendar's defaults are used
+func formatReminders(reminders *calendar.EventReminders) string {
+	if reminders == nil || reminders.UseDefault {
+		return ""
+	}
+	var parts []string
+	for _, override := range reminders.Overrides {
+		parts = append(parts, fmt.Sprintf("%s:%d", override.Method, override.Minutes))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// withCalendarRetry runs a Google Calendar API call, retrying transient failures
+// with exponential backoff and jitter until ctx is done. operation names the
+// event for the final error
+func withCalendarRetry(ctx context.Context, operation string, call func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = call()
+		if err == nil || !isRetryableCalendarError(err) || attempt >= maxCalendarRetries {
+			break
+		}
+
+		delay := calendarRetryBaseDelay << attempt
+		delay += rand.N(delay / 2)
+		slog.Warn("Transient Google Calendar error, retrying", "operation", operation,
+			"attempt", attempt+1, "retry_in", delay, "error", err)
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			err = errors.Join(err, sleepErr)
+			break
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", operation, err)
+	}
+	return nil
+}
+
+// isRetryableCalendarError reports whether a Calendar API error is worth retrying:
+// server errors, 429s and 403s caused by rate limiting. Other client errors
+// such as 400 or 404 will fail the same way again
+func isRetryableCalendarError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.Code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable:
+		return true
+	case http.StatusForbidden:
+		for _, item := range apiErr.Errors {
+			if item.Reason == "rateLimitExceeded" || item.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitManagedDescription splits a Google Calendar description at the sync marker
+// into the notes a human added above it and the Strava-managed text below it
+// Descriptions without a marker (created by older versions) are treated as fully managed
+func splitManagedDescription(description string) (humanNotes, managed string) {
+	idx := strings.Index(description, stravaSyncMarker)
+	if idx < 0 {
+		return "", strings.TrimSpace(description)
+	}
+	return strings.TrimSpace(description[:idx]), strings.TrimSpace(description[idx+len(stravaSyncMarker):])
+}
+
+// joinManagedDescription places the managed text below the sync marker,
+// keeping any human notes above it
+func joinManagedDescription(humanNotes, managed string) string {
+	description := stravaSyncMarker + "\n" + strings.TrimSpace(managed)
+	if humanNotes != "" {
+		description = humanNotes + "\n\n" + description
+	}
+	return description
+}
+
+// describeTextChange summarizes how two multi-line strings differ by showing
+// the first line that changed
+func describeTextChange(old, new string) string {
+	oldLines := strings.Split(old, "\n")
+	newLines := strings.Split(new, "\n")
+	for i := 0; i < len(oldLines) || i < len(newLines); i++ {
+		var oldLine, newLine string
+		if i < len(oldLines) {
+			oldLine = oldLines[i]
+		}
+		if i < len(newLines) {
+			newLine = newLines[i]
+		}
+		if oldLine != newLine {
+			return fmt.Sprintf("line %d %q -> %q", i+1, oldLine, newLine)
+		}
+	}
+	return "whitespace only"
+}
+
+// attendingLinePattern matches the attendee count line written by buildEventDescription
+var attendingLinePattern = regexp.MustCompile(`(?m)^\d+ attending\n?`)
+
+// formatAttending returns the description line for an attendee count, e.g. "12 attending"
+func formatAttending(count int) string {
+	return fmt.Sprintf("%d attending", count)
+}
+
+// withoutAttending removes the attendee count line from a description
+func withoutAttending(description string) string {
+	return attendingLinePattern.ReplaceAllString(description, "")
+}
+
+// sameCalendarTime reports whether a Google Calendar RFC3339 time is the same
+// instant as expected; both are compared in UTC since Google may return the
+// time with a different offset than we sent. Unparseable times never match
+func sameCalendarTime(dateTime string, expected time.Time) bool {
+	actual, err := time.Parse(time.RFC3339, dateTime)
+	if err != nil {
+		slog.Debug("Failed to parse calendar time", "date_time", dateTime, "error", err)
+		return false
+	}
+	return actual.UTC().Equal(expected.UTC())
+}
+
+// calendarEventTimes returns the Google Calendar start and end of an event, as
+// dates for all-day events (the end date is exclusive) and local times otherwise
+// Without an end time (END_TIME=none) the event ends when it starts
+func calendarEventTimes(event Event) (start, end *calendar.EventDateTime) {
+	location := eventLocation(event)
+	startLocal := event.Start.In(location)
+
+	if isAllDayEvent(event) {
+		start = &calendar.EventDateTime{Date: startLocal.Format("2006-01-02")}
+		end = &calendar.EventDateTime{Date: startLocal.AddDate(0, 0, 1).Format("2006-01-02")}
+		return start, end
+	}
+
+	endLocal := publishedEnd(event).In(location)
+	start = &calendar.EventDateTime{DateTime: startLocal.Format(time.RFC3339), TimeZone: eventZone(event)}
+	end = &calendar.EventDateTime{DateTime: endLocal.Format(time.RFC3339), TimeZone: eventZone(event)}
+	return start, end
+}
+
+// calendarEventStatus returns the Google Calendar status and transparency of an
+// event; provisional events are tentative and don't block time as busy
+func calendarEventStatus(event Event) (status, transparency string) {
+	if isTentativeEvent(event) {
+		return "tentative", "transparent"
+	}
+	return "confirmed", "opaque"
+}
+
+// createGoogleCalendarEvent creates a Google Calendar event object from a Strava event
+func createGoogleCalendarEvent(event Event, clubID string, syncTime string) *calendar.Event {
+	// Create description with all event details
+	description := joinManagedDescription("", buildGoogleEventDescription(event, clubID, syncTime))
+
+	title := calendarEventTitle(event)
+
+	start, end := calendarEventTimes(event)
+	status, transparency := calendarEventStatus(event)
+
+	return &calendar.Event{
+		Summary:      title,
+		Location:     event.Location,
+		Description:  description,
+		ColorId:      getTerrainColorID(event.Terrain),
+		Reminders:    validated().reminders, // nil keeps the calendar's default reminders
+		Start:        start,
+		End:          end,
+		Status:       status,
+		Transparency: transparency,
+		Visibility:   eventVisibility(event),
+		ICalUID:      eventUID(event),
+		Source: &calendar.EventSource{
+			Title: "Strava",
+			Url:   event.URL,
+		},
+		ExtendedProperties: &calendar.EventExtendedProperties{
+			Private: eventProperties(event, clubID),
+		},
+	}
+}
+
+// Private extended properties identifying the Strava occurrence an event was
+// created from. Events can be listed by them with the Calendar API's
+// privateExtendedProperty filter, e.g. stravaClubId=123456
+const (
+	stravaEventIDProperty = "stravaEventId"
+	stravaClubIDProperty  = "stravaClubId"
+	stravaDateProperty    = "stravaDate" // UTC date of the occurrence, as in its UID
+)
+
+// eventProperties returns the private extended properties for an occurrence
+func eventProperties(event Event, clubID string) map[string]string {
+	if event.ClubID != "" {
+		clubID = event.ClubID
+	}
+	return map[string]string{
+		stravaEventIDProperty: strconv.FormatInt(event.ID, 10),
+		stravaClubIDProperty:  clubID,
+		stravaDateProperty:    event.Start.UTC().Format("20060102"),
+	}
+}
+
+// managedEventUID returns the UID of the Strava occurrence a calendar event was
+// created from, using its extended properties and falling back to its iCalUID
+// for events created before they were set. Returns false for events this tool
+// didn't create
+func managedEventUID(gcalEvent *calendar.Event) (string, bool) {
+	if gcalEvent.ExtendedProperties != nil {
+		properties := gcalEvent.ExtendedProperties.Private
+		id, idErr := strconv.ParseInt(properties[stravaEventIDProperty], 10, 64)
+		date, dateErr := time.Parse("20060102", properties[stravaDateProperty])
+		if idErr == nil && dateErr == nil {
+			return eventUID(Event{ID: id, Start: date}), true
+		}
+	}
+	return gcalEvent.ICalUID, strings.HasSuffix(gcalEvent.ICalUID, "@strava.com")
+}
@@ -0,0 +1,260 @@
+package stravacal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	calendarAPIBase  = "https://www.googleapis.com/calendar/v3"
+	calendarBatchURL = "https://www.googleapis.com/batch/calendar/v3"
+
+	// calendarBatchSize is the most requests sent in one batch (Google allows up to 1000,
+	// but recommends keeping batches small)
+	calendarBatchSize = 50
+)
+
+// CalendarService bundles the Calendar API client with the authenticated HTTP
+// client it uses, which batch requests need to call directly
+type CalendarService struct {
+	*calendar.Service
+	httpClient *http.Client
+	account    string // Who the service acts as, e.g. "service account sync@project.iam.gserviceaccount.com"
+}
+
+// calendarOperation is a single create, update or delete queued for a batch
+type calendarOperation struct {
+	action    string          // "create", "update" or "delete"
+	method    string          // HTTP method
+	path      string          // Path below calendarAPIBase
+	body      *calendar.Event // Request body, nil for deletes
+	operation string          // Description naming the event, used in errors
+	success   string          // Log message on success
+	logAttrs  []any           // Structured log fields identifying the event
+}
+
+// newCreateOperation queues importing a new event (Import handles iCalUID-based creates)
+func newCreateOperation(calendarID string, event *calendar.Event, logAttrs ...any) calendarOperation {
+	return calendarOperation{
+		action:    "create",
+		method:    http.MethodPost,
+		path:      fmt.Sprintf("/calendars/%s/events/import", url.PathEscape(calendarID)),
+		body:      event,
+		operation: fmt.Sprintf("create event %s (%s)", event.ICalUID, event.Summary),
+		success:   "Created event",
+		logAttrs:  logAttrs,
+	}
+}
+
+// newUpdateOperation queues replacing an existing event
+func newUpdateOperation(calendarID, eventID string, event *calendar.Event, logAttrs ...any) calendarOperation {
+	return calendarOperation{
+		action:    "update",
+		method:    http.MethodPut,
+		path:      fmt.Sprintf("/calendars/%s/events/%s", url.PathEscape(calendarID), url.PathEscape(eventID)),
+		body:      event,
+		operation: fmt.Sprintf("update event %s (%s)", event.ICalUID, event.Summary),
+		success:   "Updated event",
+		logAttrs:  logAttrs,
+	}
+}
+
+// newDeleteOperation queues deleting an event
+func newDeleteOperation(calendarID string, gcalEvent *calendar.Event, logAttrs ...any) calendarOperation {
+	return calendarOperation{
+		action:    "delete",
+		method:    http.MethodDelete,
+		path:      fmt.Sprintf("/calendars/%s/events/%s", url.PathEscape(calendarID), url.PathEscape(gcalEvent.Id)),
+		operation: fmt.Sprintf("delete event %s (%s)", gcalEvent.ICalUID, gcalEvent.Summary),
+		success:   "Deleted event (no longer on Strava)",
+		logAttrs:  logAttrs,
+	}
+}
+
+// executeCalendarOperations sends operations in batches of calendarBatchSize,
+// logging the outcome of each one. Items that fail with a transient error are
+// retried in a later batch with exponential backoff and jitter. After each
+// batch, onBatch (if set) is called with the indexes of the operations it made
+// Returns the error for each operation, nil where it succeeded
+func executeCalendarOperations(ctx context.Context, srv *CalendarService, operations []calendarOperation, onBatch func(done []int)) []error {
+	results := make([]error, len(operations))
+
+	// Indexes into operations still to be sent
+	pending := make([]int, len(operations))
+	for i := range operations {
+		pending[i] = i
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			delay := calendarRetryBaseDelay << (attempt - 1)
+			delay += rand.N(delay / 2)
+			slog.Warn("Transient Google Calendar errors, retrying", "operations", len(pending),
+				"attempt", attempt, "retry_in", delay)
+			if err := sleepContext(ctx, delay); err != nil {
+				for _, index := range pending {
+					results[index] = fmt.Errorf("failed to %s: %w", operations[index].operation, err)
+				}
+				break
+			}
+		}
+
+		var retry []int
+		for start := 0; start < len(pending); start += calendarBatchSize {
+			indexes := pending[start:min(start+calendarBatchSize, len(pending))]
+			batch := make([]calendarOperation, len(indexes))
+			for i, index := range indexes {
+				batch[i] = operations[index]
+			}
+
+			batchResults := executeCalendarBatch(ctx, srv.httpClient, batch)
+			var done []int
+			for i, op := range batch {
+				err := batchResults[i]
+				if err == nil {
+					slog.Info(op.success, append([]any{"action", op.action}, op.logAttrs...)...)
+					done = append(done, indexes[i])
+					continue
+				}
+
+				if isRetryableCalendarError(err) && attempt < maxCalendarRetries {
+					retry = append(retry, indexes[i])
+					continue
+				}
+
+				err = fmt.Errorf("failed to %s: %w", op.operation, err)
+				slog.Error("Failed to "+op.action+" event", append([]any{"action", op.action}, append(op.logAttrs, "error", err)...)...)
+				results[indexes[i]] = err
+			}
+			if onBatch != nil && len(done) > 0 {
+				onBatch(done)
+			}
+		}
+		pending = retry
+	}
+
+	return results
+}
+
+// executeCalendarBatch sends up to calendarBatchSize operations as a single
+// multipart/mixed batch request and returns the error (or nil) for each item
+func executeCalendarBatch(ctx context.Context, client *http.Client, batch []calendarOperation) []error {
+	results := make([]error, len(batch))
+	failAll := func(err error) []error {
+		for i := range results {
+			results[i] = err
+		}
+		return results
+	}
+
+	// Build the multipart body, one embedded HTTP request per part
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for i, op := range batch {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-ID":   {fmt.Sprintf("<item-%d>", i)},
+		})
+		if err != nil {
+			return failAll(fmt.Errorf("failed to build batch request: %w", err))
+		}
+
+		var payload io.Reader
+		if op.body != nil {
+			data, err := json.Marshal(op.body)
+			if err != nil {
+				return failAll(fmt.Errorf("failed to encode event for %s: %w", op.operation, err))
+			}
+			payload = bytes.NewReader(data)
+		}
+
+		req, err := http.NewRequest(op.method, calendarAPIBase+op.path, payload)
+		if err != nil {
+			return failAll(fmt.Errorf("failed to build batch request: %w", err))
+		}
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if err := req.Write(part); err != nil {
+			return failAll(fmt.Errorf("failed to build batch request: %w", err))
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return failAll(fmt.Errorf("failed to build batch request: %w", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, calendarBatchURL, &body)
+	if err != nil {
+		return failAll(fmt.Errorf("failed to create batch request: %w", err))
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return failAll(fmt.Errorf("batch request failed: %w", err))
+	}
+	defer resp.Body.Close()
+
+	// A failure of the whole batch (e.g. rate limiting) applies to every item
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return failAll(err)
+	}
+
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return failAll(fmt.Errorf("invalid batch response content type: %w", err))
+	}
+
+	// Match each response part back to its request by Content-ID
+	answered := make([]bool, len(batch))
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return failAll(fmt.Errorf("failed to read batch response: %w", err))
+		}
+
+		contentID := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		i, err := strconv.Atoi(strings.TrimPrefix(contentID, "response-item-"))
+		if err != nil || i < 0 || i >= len(batch) {
+			continue
+		}
+
+		answered[i] = true
+		itemResp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			results[i] = fmt.Errorf("failed to read batch item response: %w", err)
+			continue
+		}
+		results[i] = googleapi.CheckResponse(itemResp)
+		itemResp.Body.Close()
+	}
+
+	for i := range batch {
+		if !answered[i] {
+			results[i] = errors.New("no response for item in batch")
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,179 @@
+package stravacal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// calendarEventCacheTTL is how long a calendar's cached events are kept up to date
+// with incremental changes before the whole calendar is listed again
+const calendarEventCacheTTL = time.Hour
+
+// eventCache holds the last known events of each calendar between syncs. It is
+// only set by the serve command, where syncs run every few minutes; one-off
+// commands list the sync window directly
+var eventCache *calendarEventCache
+
+// calendarEventCache keeps the events of each calendar, keyed by calendar ID,
+// along with the sync token for fetching only what changed since
+type calendarEventCache struct {
+	mu      sync.Mutex
+	entries map[string]*calendarCacheEntry
+}
+
+// calendarCacheEntry is the known state of one calendar
+type calendarCacheEntry struct {
+	events    map[string]*calendar.Event // By Google Calendar event ID
+	syncToken string
+	listedAt  time.Time // When the calendar was last listed in full
+}
+
+// newCalendarEventCache returns an empty cache
+func newCalendarEventCache() *calendarEventCache {
+	return &calendarEventCache{entries: make(map[string]*calendarCacheEntry)}
+}
+
+// listCalendarEvents returns the events of a calendar that overlap [timeMin, timeMax),
+// from eventCache when it is set
+func listCalendarEvents(ctx context.Context, srv *CalendarService, calendarID string, timeMin, timeMax time.Time) ([]*calendar.Event, error) {
+	if eventCache != nil {
+		return eventCache.list(ctx, srv, calendarID, timeMin, timeMax)
+	}
+
+	var existingEvents *calendar.Events
+	err := withCalendarRetry(ctx, "list existing calendar events", func() error {
+		var err error
+		existingEvents, err = srv.Events.List(calendarID).
+			Context(ctx).
+			TimeMin(timeMin.Format(time.RFC3339)).
+			TimeMax(timeMax.Format(time.RFC3339)).
+			SingleEvents(true).
+			Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existingEvents.Items, nil
+}
+
+// list brings the cached events of a calendar up to date and returns the ones
+// overlapping [timeMin, timeMax). Only changes are fetched while the sync token
+// is valid; the calendar is listed in full when the entry is missing, older than
+// calendarEventCacheTTL, or Google expires the token (410 Gone)
+func (c *calendarEventCache) list(ctx context.Context, srv *CalendarService, calendarID string, timeMin, timeMax time.Time) ([]*calendar.Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entries[calendarID]
+	if entry != nil && time.Since(entry.listedAt) < calendarEventCacheTTL {
+		err := entry.fetch(ctx, srv, calendarID)
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+			slog.Info("Calendar sync token expired, listing all events", "calendar_id", calendarID)
+			entry = nil
+		} else if err != nil {
+			// Changes may have been applied partially, so start again next time
+			delete(c.entries, calendarID)
+			return nil, err
+		} else {
+			slog.Debug("Updated cached calendar events", "calendar_id", calendarID, "events", len(entry.events))
+		}
+	} else {
+		entry = nil
+	}
+
+	if entry == nil {
+		entry = &calendarCacheEntry{events: make(map[string]*calendar.Event), listedAt: time.Now()}
+		if err := entry.fetch(ctx, srv, calendarID); err != nil {
+			delete(c.entries, calendarID)
+			return nil, err
+		}
+		c.entries[calendarID] = entry
+		slog.Debug("Listed all calendar events", "calendar_id", calendarID, "events", len(entry.events))
+	}
+
+	var events []*calendar.Event
+	for _, event := range entry.events {
+		if eventOverlaps(event, timeMin, timeMax) {
+			events = append(events, event)
+		}
+	}
+	// In start order like a listed window, so the diff doesn't vary between runs
+	sort.Slice(events, func(i, j int) bool {
+		start, _ := parseEventDateTime(events[i].Start)
+		otherStart, _ := parseEventDateTime(events[j].Start)
+		if !start.Equal(otherStart) {
+			return start.Before(otherStart)
+		}
+		return events[i].Id < events[j].Id
+	})
+	return events, nil
+}
+
+// fetch applies every event changed since the entry's sync token, or every
+// event in the calendar when there is no token yet, and stores the next token
+func (e *calendarCacheEntry) fetch(ctx context.Context, srv *CalendarService, calendarID string) error {
+	var nextSyncToken string
+	err := withCalendarRetry(ctx, "list calendar event changes", func() error {
+		call := srv.Events.List(calendarID).Context(ctx).SingleEvents(true)
+		if e.syncToken != "" {
+			call = call.SyncToken(e.syncToken)
+		}
+		return call.Pages(ctx, func(page *calendar.Events) error {
+			for _, event := range page.Items {
+				// Incremental results include deleted events as cancelled
+				if event.Status == "cancelled" {
+					delete(e.events, event.Id)
+				} else {
+					e.events[event.Id] = event
+				}
+			}
+			if page.NextSyncToken != "" {
+				nextSyncToken = page.NextSyncToken
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if nextSyncToken == "" {
+		return fmt.Errorf("calendar %s returned no sync token", calendarID)
+	}
+	e.syncToken = nextSyncToken
+	return nil
+}
+
+// eventOverlaps reports whether a Google Calendar event overlaps [timeMin, timeMax)
+// All-day dates are taken as UTC, and events with unreadable times are included
+func eventOverlaps(event *calendar.Event, timeMin, timeMax time.Time) bool {
+	start, startOK := parseEventDateTime(event.Start)
+	end, endOK := parseEventDateTime(event.End)
+	if !startOK || !endOK {
+		return true
+	}
+	return end.After(timeMin) && start.Before(timeMax)
+}
+
+// parseEventDateTime returns the time of a timed or all-day event boundary
+func parseEventDateTime(dateTime *calendar.EventDateTime) (time.Time, bool) {
+	if dateTime == nil {
+		return time.Time{}, false
+	}
+	if dateTime.DateTime != "" {
+		t, err := time.Parse(time.RFC3339, dateTime.DateTime)
+		return t, err == nil
+	}
+	t, err := time.Parse("2006-01-02", dateTime.Date)
+	return t, err == nil
+}
@@ -0,0 +1,109 @@
+package stravacal
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// droppedHTMLPattern matches comments and elements whose content is never
+	// shown, which are removed whole
+	droppedHTMLPattern = regexp.MustCompile(`(?is)<!--.*?-->|<(script|style|iframe|object|embed|template)\b.*?</(script|style|iframe|object|embed|template)\s*>`)
+
+	// htmlTagPattern matches an opening or closing tag, capturing the slash,
+	// the tag name and its attributes
+	htmlTagPattern = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9]*)([^<>]*)>`)
+
+	// hrefPattern matches a link's href attribute, quoted or not
+	hrefPattern = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// allowedDescriptionTags are the tags kept in HTML Google Calendar descriptions
+var allowedDescriptionTags = map[string]bool{
+	"p": true, "br": true, "ul": true, "li": true, "strong": true, "em": true, "a": true,
+}
+
+// getGoogleDescriptionFormat returns how Strava descriptions are written to
+// Google Calendar, from GOOGLE_DESCRIPTION_FORMAT:
+// - "text" (default): as Strava provides them
+// - "html": with the formatting in allowedDescriptionTags kept and all other
+// markup removed (see sanitizeDescriptionHTML)
+// The ICS file always has plain text
+func getGoogleDescriptionFormat() (string, error) {
+	format := strings.ToLower(getenv("GOOGLE_DESCRIPTION_FORMAT"))
+	switch format {
+	case "":
+		return "text", nil
+	case "text", "html":
+		return format, nil
+	default:
+		return "", fmt.Errorf("GOOGLE_DESCRIPTION_FORMAT must be text or html, got %q", format)
+	}
+}
+
+// buildGoogleEventDescription is buildEventDescription for Google Calendar,
+// with the Strava description sanitized when GOOGLE_DESCRIPTION_FORMAT is html
+func buildGoogleEventDescription(event Event, clubID string, syncTime string) string {
+	if validated().descriptionFormat == "html" {
+		event.Description = sanitizeDescriptionHTML(event.Description)
+	}
+	return buildEventDescription(event, clubID, syncTime)
+}
+
+// sanitizeDescriptionHTML keeps only the tags in allowedDescriptionTags, with
+// no attributes except an http, https or mailto href on links. Scripts, styles
+// and comments are removed with their content, other tags are removed leaving
+// their text, and the text is escaped so nothing else is read as markup
+func sanitizeDescriptionHTML(description string) string {
+	description = droppedHTMLPattern.ReplaceAllString(description, "")
+
+	var sanitized strings.Builder
+	last := 0
+	for _, match := range htmlTagPattern.FindAllStringSubmatchIndex(description, -1) {
+		sanitized.WriteString(html.EscapeString(description[last:match[0]]))
+		last = match[1]
+
+		closing := match[3] > match[2]
+		name := strings.ToLower(description[match[4]:match[5]])
+		if !allowedDescriptionTags[name] {
+			continue
+		}
+		switch {
+		case closing && name != "br":
+			sanitized.WriteString("</" + name + ">")
+		case closing:
+			// </br> is read as <br> by browsers
+			sanitized.WriteString("<br>")
+		case name == "a":
+			sanitized.WriteString(sanitizeLinkTag(description[match[6]:match[7]]))
+		default:
+			sanitized.WriteString("<" + name + ">")
+		}
+	}
+	sanitized.WriteString(html.EscapeString(description[last:]))
+
+	return sanitized.String()
+}
+
+// sanitizeLinkTag returns an opening <a> tag keeping only the href from attrs,
+// and only when it is an http, https or mailto URL
+func sanitizeLinkTag(attrs string) string {
+	match := hrefPattern.FindStringSubmatch(attrs)
+	if match == nil {
+		return "<a>"
+	}
+	href := html.UnescapeString(match[1] + match[2] + match[3])
+	parsed, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "<a>"
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto":
+		return fmt.Sprintf("<a href=\"%s\">", html.EscapeString(parsed.String()))
+	default:
+		return "<a>"
+	}
+}
@@ -0,0 +1,95 @@
+package stravacal
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEvent returns an occurrence of a club event as convertStravaEvent would
+func testEvent(id int64, start time.Time) Event {
+	return Event{
+		ID:           id,
+		Title:        "Tuesday Tempo",
+		Start:        start,
+		End:          start.Add(time.Hour),
+		URL:          "https://www.strava.com/clubs/123/group_events/1",
+		ClubID:       "123",
+		Organizer:    "Jane Smith",
+		ActivityType: "Run",
+		Zone:         "Europe/London",
+	}
+}
+
+func TestCalendarEventChangesUpToDate(t *testing.T) {
+	withSettings(t, nil)
+
+	const syncTime = "Tue, 7 Jan @ 6:00 PM"
+	event := testEvent(1, time.Date(2030, 7, 2, 17, 30, 0, 0, time.UTC))
+
+	tests := []struct {
+		name  string
+		start string // Overrides the stored times when set
+		end   string
+	}{
+		{name: "as created"},
+		// Google can return a time with another offset than was sent
+		{name: "UTC offset", start: "2030-07-02T17:30:00Z", end: "2030-07-02T18:30:00Z"},
+		{name: "non-UTC offset", start: "2030-07-02T19:30:00+02:00", end: "2030-07-02T13:30:00-05:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gcalEvent := createGoogleCalendarEvent(event, "123", syncTime)
+			if tt.start != "" {
+				gcalEvent.Start.DateTime = tt.start
+				gcalEvent.End.DateTime = tt.end
+			}
+			if changes := calendarEventChanges(gcalEvent, event, "123", syncTime); len(changes) > 0 {
+				t.Errorf("calendarEventChanges found changes for a synced event: %q", changes)
+			}
+		})
+	}
+
+	// A moved event is still updated
+	gcalEvent := createGoogleCalendarEvent(event, "123", syncTime)
+	gcalEvent.Start.DateTime = "2030-07-02T19:00:00+02:00"
+	if changes := calendarEventChanges(gcalEvent, event, "123", syncTime); len(changes) != 1 {
+		t.Errorf("calendarEventChanges = %q, want just the start", changes)
+	}
+}
+
+func TestDecodeServiceAccountKey(t *testing.T) {
+	const key = `{"type": "service_account", "client_email": "sync@example.iam.gserviceaccount.com"}`
+	encoded := base64.StdEncoding.EncodeToString([]byte(key))
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"raw JSON", key},
+		{"raw JSON with whitespace", "\n  " + key + "\n"},
+		{"base64 JSON", encoded},
+		{"wrapped base64 JSON", encoded[:40] + "\n" + encoded[40:]},
+		{"unpadded base64 JSON", strings.TrimRight(encoded, "=")},
+		{"URL-safe base64 JSON", base64.URLEncoding.EncodeToString([]byte(key))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeServiceAccountKey(tt.value)
+			if err != nil {
+				t.Fatalf("decodeServiceAccountKey: %v", err)
+			}
+			if string(got) != key {
+				t.Errorf("decodeServiceAccountKey = %q, want %q", got, key)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "not a key", base64.StdEncoding.EncodeToString([]byte("not JSON")), `{"type": `} {
+		_, err := decodeServiceAccountKey(value)
+		if err == nil || !strings.Contains(err.Error(), "GOOGLE_SERVICE_ACCOUNT must be") {
+			t.Errorf("decodeServiceAccountKey(%q) error = %v, want a clear error", value, err)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package stravacal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// geocodeCacheFile maps rounded coordinates to place names, relative to OUTPUT_DIR; excluded from the GitHub Pages deploy
+	geocodeCacheFile = "cache/geocode.json"
+
+	nominatimReverseURL     = "https://nominatim.openstreetmap.org/reverse"
+	googleGeocodingURL      = "https://maps.googleapis.com/maps/api/geocode/json"
+	geocodeUserAgent        = "StravaCal (https://github.com/bkach/StravaCal)"
+	nominatimRequestSpacing = 1 * time.Second // Nominatim's usage policy allows one request per second
+)
+
+// coordinateAddressPattern matches addresses that are just "lat, lng"
+var coordinateAddressPattern = regexp.MustCompile(`^\s*(-?\d+(?:\.\d+)?)\s*,\s*(-?\d+(?:\.\d+)?)\s*$`)
+
+// parseCoordinateAddress returns the latitude and longitude of an address that
+// is just "lat, lng", or ok false for any other address
+func parseCoordinateAddress(address string) (lat, lng float64, ok bool) {
+	match := coordinateAddressPattern.FindStringSubmatch(address)
+	if match == nil {
+		return 0, 0, false
+	}
+	lat, latErr := strconv.ParseFloat(match[1], 64)
+	lng, lngErr := strconv.ParseFloat(match[2], 64)
+	if latErr != nil || lngErr != nil || math.Abs(lat) > 90 || math.Abs(lng) > 180 {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// formatCoordinates returns a short readable form of a position, such as
+// "52.1234°N, 2.3456°W"
+func formatCoordinates(lat, lng float64) string {
+	latHemisphere, lngHemisphere := "N", "E"
+	if lat < 0 {
+		latHemisphere = "S"
+	}
+	if lng < 0 {
+		lngHemisphere = "W"
+	}
+	return fmt.Sprintf("%.4f°%s, %.4f°%s", math.Abs(lat), latHemisphere, math.Abs(lng), lngHemisphere)
+}
+
+// formatCoordinateLocations replaces locations that are still raw coordinates,
+// because geocoding is disabled or failed, with "Meeting point (52.1234°N,
+// 2.3456°W)". Textual addresses are left alone, and the coordinates themselves
+// are kept for the GEO property and map link
+func formatCoordinateLocations(events []Event) {
+	for i := range events {
+		lat, lng, ok := parseCoordinateAddress(events[i].Location)
+		if !ok {
+			continue
+		}
+		events[i].Location = fmt.Sprintf("Meeting point (%s)", formatCoordinates(lat, lng))
+	}
+}
+
+// geocoder turns meeting point coordinates into readable place names
+type geocoder struct {
+	provider    string // "nominatim" or "google"
+	endpoint    string
+	apiKey      string
+	cache       map[string]string
+	client      *http.Client
+	lastRequest time.Time
+}
+
+// getGeocoder returns the reverse geocoder configured by environment variables,
+// or nil when geocoding is disabled (the default)
+// - GEOCODER: "nominatim" or "google"
+// - GEOCODER_URL: Override the provider's endpoint, e.g. for a self-hosted Nominatim
+// - GOOGLE_GEOCODING_API_KEY: Required for the google provider
+func getGeocoder() (*geocoder, error) {
+	g := &geocoder{
+		provider: strings.ToLower(getenv("GEOCODER")),
+		endpoint: getenv("GEOCODER_URL"),
+		apiKey:   getenv("GOOGLE_GEOCODING_API_KEY"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+
+	switch g.provider {
+	case "":
+		return nil, nil
+	case "nominatim":
+		if g.endpoint == "" {
+			g.endpoint = nominatimReverseURL
+		}
+	case "google":
+		if g.endpoint == "" {
+			g.endpoint = googleGeocodingURL
+		}
+		if g.apiKey == "" {
+			return nil, fmt.Errorf("GOOGLE_GEOCODING_API_KEY must be set when GEOCODER is google")
+		}
+	default:
+		return nil, fmt.Errorf("GEOCODER must be nominatim or google, got %q", g.provider)
+	}
+
+	return g, nil
+}
+
+// resolveLocations replaces blank or coordinate-only locations with place names
+// Geocoding is best effort: events keep their original address on any failure,
+// and the rest are left as they are once ctx is done. Coordinates that aren't
+// resolved are then formatted readably (see formatCoordinateLocations)
+func resolveLocations(ctx context.Context, events []Event) {
+	defer formatCoordinateLocations(events)
+
+	g, err := getGeocoder()
+	if err != nil || g == nil {
+		return
+	}
+
+	cache, err := loadGeocodeCache()
+	if err != nil {
+		slog.Warn("Ignoring geocode cache", "error", err)
+		cache = make(map[string]string)
+	}
+	g.cache = cache
+
+	for i := range events {
+		if ctx.Err() != nil {
+			break
+		}
+		g.resolveLocation(ctx, &events[i])
+	}
+
+	if err := saveGeocodeCache(g.cache); err != nil {
+		slog.Warn("Failed to save geocode cache", "error", err)
+	}
+}
+
+// resolveLocation sets a readable location for an event whose address is
+// blank or raw coordinates, using the cache before asking the provider
+func (g *geocoder) resolveLocation(ctx context.Context, event *Event) {
+	if strings.TrimSpace(event.Location) != "" && !coordinateAddressPattern.MatchString(event.Location) {
+		return
+	}
+	lat, lng, ok := eventCoordinates(*event)
+	if !ok {
+		return
+	}
+
+	// Round to 4 decimal places (about 11m) so nearby meeting points share an entry
+	key := fmt.Sprintf("%.4f,%.4f", lat, lng)
+	if name, ok := g.cache[key]; ok {
+		event.Location = name
+		return
+	}
+
+	name, err := g.reverseGeocode(ctx, lat, lng)
+	if err != nil {
+		slog.Warn("Failed to geocode location", "event_id", event.ID, "coordinates", key, "error", err)
+		return
+	}
+	if name == "" {
+		return
+	}
+
+	g.cache[key] = name
+	event.Location = name
+	slog.Debug("Geocoded location", "event_id", event.ID, "coordinates", key, "location", name)
+}
+
+// reverseGeocode asks the provider for the place name at lat, lng
+func (g *geocoder) reverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
+	params := url.Values{}
+	switch g.provider {
+	case "nominatim":
+		// Respect Nominatim's rate limit between uncached lookups
+		if wait := nominatimRequestSpacing - time.Since(g.lastRequest); wait > 0 {
+			if err := sleepContext(ctx, wait); err != nil {
+				return "", err
+			}
+		}
+		params.Set("format", "jsonv2")
+		params.Set("lat", fmt.Sprintf("%f", lat))
+		params.Set("lon", fmt.Sprintf("%f", lng))
+	case "google":
+		params.Set("latlng", fmt.Sprintf("%f,%f", lat, lng))
+		params.Set("key", g.apiKey)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", geocodeUserAgent)
+
+	g.lastRequest = time.Now()
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("geocoding failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if g.provider == "google" {
+		var result struct {
+			Status  string `json:"status"`
+			Results []struct {
+				FormattedAddress string `json:"formatted_address"`
+			} `json:"results"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return "", fmt.Errorf("failed to decode geocoding response: %w", err)
+		}
+		if result.Status == "ZERO_RESULTS" {
+			return "", nil
+		}
+		if result.Status != "OK" || len(result.Results) == 0 {
+			return "", fmt.Errorf("geocoding failed with status %s", result.Status)
+		}
+		return result.Results[0].FormattedAddress, nil
+	}
+
+	var result struct {
+		DisplayName string `json:"display_name"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode geocoding response: %w", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("geocoding failed: %s", result.Error)
+	}
+	return result.DisplayName, nil
+}
+
+// loadGeocodeCache reads place names saved by previous runs
+// Returns an empty cache without error if no cache file exists
+func loadGeocodeCache() (map[string]string, error) {
+	cache := make(map[string]string)
+	data, err := os.ReadFile(outputPath(geocodeCacheFile))
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geocode cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("failed to parse geocode cache: %w", err)
+	}
+	return cache, nil
+}
+
+// saveGeocodeCache persists place names for reuse by later runs
+func saveGeocodeCache(cache map[string]string) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal geocode cache: %w", err)
+	}
+
+	if err := writeOutputFile(geocodeCacheFile, data); err != nil {
+		return fmt.Errorf("failed to write geocode cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package stravacal
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// heartbeatTimeout keeps a slow or down monitoring service from holding up the run
+const heartbeatTimeout = 10 * time.Second
+
+// pingHeartbeat notifies the healthcheck at HEARTBEAT_URL of the run's outcome
+// status is "success" or "fail"; failures are sent to HEARTBEAT_URL/fail with
+// the error as the body (the convention used by healthchecks.io and similar)
+// Does nothing if HEARTBEAT_URL is unset, and problems reaching it are only logged
+func pingHeartbeat(status string, err error) {
+	heartbeatURL := getenv("HEARTBEAT_URL")
+	if heartbeatURL == "" {
+		return
+	}
+
+	pingURL := heartbeatURL
+	body := ""
+	if status == "fail" {
+		pingURL = strings.TrimSuffix(heartbeatURL, "/") + "/fail"
+		if err != nil {
+			body = err.Error()
+		}
+	}
+
+	client := &http.Client{Timeout: heartbeatTimeout}
+	resp, postErr := client.Post(pingURL, "text/plain; charset=utf-8", strings.NewReader(body))
+	if postErr != nil {
+		slog.Warn("Failed to send heartbeat", "status", status, "error", postErr)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		slog.Warn("Heartbeat rejected", "status", status, "http_status", resp.StatusCode)
+		return
+	}
+	slog.Debug("Sent heartbeat", "status", status)
+}
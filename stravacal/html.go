@@ -0,0 +1,153 @@
+package stravacal
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// generateHTMLSchedule creates a standalone HTML page listing events grouped by date
+// Events are expected to be sorted chronologically. All Strava-supplied text is
+// HTML-escaped since titles and locations are written by club members
+func generateHTMLSchedule(events []Event) string {
+	var page strings.Builder
+
+	page.WriteString("<!DOCTYPE html>\n")
+	page.WriteString("<html lang=\"en\">\n")
+	page.WriteString("<head>\n")
+	page.WriteString("<meta charset=\"utf-8\">\n")
+	page.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	page.WriteString(fmt.Sprintf("<title>%s - Upcoming Runs</title>\n", html.EscapeString(getCalendarName())))
+	page.WriteString(formatHTMLStyle())
+	page.WriteString("</head>\n")
+	page.WriteString("<body>\n")
+	page.WriteString(fmt.Sprintf("<h1>%s</h1>\n", html.EscapeString(getCalendarName())))
+
+	// Show when the schedule was generated, in the club's timezone
+	updated := time.Now()
+	if loc, err := time.LoadLocation(getDefaultTimezone()); err == nil {
+		updated = updated.In(loc)
+	}
+	page.WriteString(fmt.Sprintf("<p class=\"updated\">Last updated: %s</p>\n", updated.Format("Mon 2 Jan 2006, 3:04 PM MST")))
+
+	if len(events) == 0 {
+		page.WriteString("<p>No upcoming events.</p>\n")
+	}
+	page.WriteString(formatHTMLEventsByDate(events))
+
+	page.WriteString("</body>\n")
+	page.WriteString("</html>\n")
+
+	return page.String()
+}
+
+// formatHTMLStyle returns the stylesheet for the HTML schedule and email digest
+func formatHTMLStyle() string {
+	var style strings.Builder
+	style.WriteString("<style>\n")
+	style.WriteString("body { font-family: -apple-system, BlinkMacSystemFont, \"Segoe UI\", Roboto, sans-serif; margin: 0 auto; max-width: 48rem; padding: 1rem; color: #222; }\n")
+	style.WriteString("h1 { font-size: 1.5rem; }\n")
+	style.WriteString("h2 { font-size: 1.1rem; border-bottom: 2px solid #fc4c02; padding-bottom: 0.25rem; margin-top: 2rem; }\n")
+	style.WriteString(".event { padding: 0.75rem 0; border-bottom: 1px solid #eee; }\n")
+	style.WriteString(".event h3 { font-size: 1rem; margin: 0 0 0.25rem; }\n")
+	style.WriteString(".event p { margin: 0.15rem 0; font-size: 0.9rem; }\n")
+	style.WriteString(".time { font-weight: bold; }\n")
+	style.WriteString(".meta { color: #666; }\n")
+	style.WriteString(".cancelled { color: #999; }\n")
+	style.WriteString(".updated { color: #666; font-size: 0.9rem; margin-top: -0.5rem; }\n")
+	style.WriteString(".photo { display: block; max-width: 100%; border-radius: 4px; margin: 0.5rem 0; }\n")
+	style.WriteString("a { color: #fc4c02; }\n")
+	style.WriteString("</style>\n")
+	return style.String()
+}
+
+// formatHTMLEventsByDate renders events, sorted chronologically, in a section
+// for each local date; shared by the HTML schedule and the email digest
+func formatHTMLEventsByDate(events []Event) string {
+	var sections strings.Builder
+
+	currentDate := ""
+	for _, event := range events {
+		location := eventLocation(event)
+		startLocal := event.Start.In(location)
+		endLocal := event.End.In(location)
+
+		date := startLocal.Format("Monday 2 January")
+		if date != currentDate {
+			if currentDate != "" {
+				sections.WriteString("</section>\n")
+			}
+			sections.WriteString("<section>\n")
+			sections.WriteString(fmt.Sprintf("<h2>%s</h2>\n", html.EscapeString(date)))
+			currentDate = date
+		}
+
+		sections.WriteString(formatHTMLEvent(event, startLocal, endLocal))
+	}
+	if currentDate != "" {
+		sections.WriteString("</section>\n")
+	}
+
+	return sections.String()
+}
+
+// formatHTMLEvent renders a single event entry for the HTML schedule
+func formatHTMLEvent(event Event, startLocal, endLocal time.Time) string {
+	var entry strings.Builder
+
+	if event.CancelledAt != nil {
+		entry.WriteString("<div class=\"event cancelled\">\n")
+		entry.WriteString(fmt.Sprintf("<h3><s>%s</s> (Cancelled)</h3>\n", html.EscapeString(event.Title)))
+	} else {
+		entry.WriteString("<div class=\"event\">\n")
+		entry.WriteString(fmt.Sprintf("<h3>%s</h3>\n", html.EscapeString(event.Title)))
+	}
+	if isAllDayEvent(event) {
+		entry.WriteString("<p class=\"time\">All day</p>\n")
+	} else if !hasEndTime(event) {
+		entry.WriteString(fmt.Sprintf("<p class=\"time\">%s, duration TBC</p>\n", startLocal.Format("3:04 PM")))
+	} else if _, ok := distanceDuration(event.ActivityType, event.Distance); ok {
+		entry.WriteString(fmt.Sprintf("<p class=\"time\">%s – %s (approximate finish)</p>\n", startLocal.Format("3:04 PM"), endLocal.Format("3:04 PM")))
+	} else {
+		entry.WriteString(fmt.Sprintf("<p class=\"time\">%s – %s (estimated end)</p>\n", startLocal.Format("3:04 PM"), endLocal.Format("3:04 PM")))
+	}
+
+	if event.PhotoURL != "" {
+		entry.WriteString(fmt.Sprintf("<img class=\"photo\" src=\"%s\" alt=\"\" loading=\"lazy\">\n", html.EscapeString(event.PhotoURL)))
+	}
+
+	metadata := formatEventMetadata(event.SkillLevels, event.Terrain)
+	if distance := formatDistance(event.Distance); distance != "" {
+		if metadata != "" {
+			metadata += " / "
+		}
+		metadata += distance
+	}
+	if event.Attending != nil {
+		if metadata != "" {
+			metadata += " / "
+		}
+		metadata += formatAttending(*event.Attending)
+	}
+	if metadata != "" {
+		entry.WriteString(fmt.Sprintf("<p class=\"meta\">%s</p>\n", html.EscapeString(metadata)))
+	}
+
+	if event.Location != "" {
+		locationText := html.EscapeString(event.Location)
+		if mapURL := getMapURL(event); mapURL != "" {
+			locationText = fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(mapURL), locationText)
+		}
+		entry.WriteString(fmt.Sprintf("<p>📍 %s</p>\n", locationText))
+	}
+
+	if event.Organizer != "" {
+		entry.WriteString(fmt.Sprintf("<p>Leader: %s</p>\n", html.EscapeString(event.Organizer)))
+	}
+
+	entry.WriteString(fmt.Sprintf("<p><a href=\"%s\">View on Strava</a></p>\n", html.EscapeString(event.URL)))
+	entry.WriteString("</div>\n")
+
+	return entry.String()
+}
@@ -0,0 +1,866 @@
+package stravacal
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Calendar header defaults, overridden by ICS_CALENDAR_NAME, ICS_CALENDAR_DESC and ICS_PRODID
+const (
+	defaultCalendarName        = "Malvern Buzzards Running Club"
+	defaultCalendarDescription = "Club running events from Strava"
+	defaultCalendarProdID      = "-//StravaCal//Strava Club Events//EN"
+)
+
+// icsRefreshInterval asks subscribed clients to check for updates as often as
+// the scheduled sync runs (every 15 minutes)
+const icsRefreshInterval = "PT15M"
+
+// icsDurationPattern matches an RFC 5545 duration such as P1D, PT1H30M or P2W,
+// with an optional sign
+var icsDurationPattern = regexp.MustCompile(`^[+-]?P(\d+W|\d+D(T(\d+H)?(\d+M)?(\d+S)?)?|T(\d+H)?(\d+M)?(\d+S)?)$`)
+
+// getICSReminders returns the alarm triggers for ICS events from ICS_REMINDERS,
+// comma-separated ISO 8601 durations before the start such as "P1D,PT1H"
+// A leading "+" sets an alarm after the start. Invalid durations are skipped with
+// a warning rather than written into the calendar
+func getICSReminders() []string {
+	value := getenv("ICS_REMINDERS")
+	if value == "" {
+		return nil
+	}
+
+	var triggers []string
+	for _, part := range strings.Split(value, ",") {
+		duration := strings.ToUpper(strings.TrimSpace(part))
+		if !icsDurationPattern.MatchString(duration) || strings.HasSuffix(duration, "T") {
+			slog.Warn("Skipping invalid ICS_REMINDERS duration", "duration", part)
+			continue
+		}
+		if !strings.HasPrefix(duration, "+") && !strings.HasPrefix(duration, "-") {
+			duration = "-" + duration
+		}
+		triggers = append(triggers, duration)
+	}
+	return triggers
+}
+
+// getStableTimestamps reports whether STABLE_TIMESTAMPS is set, which leaves
+// the generation time out of the ICS file so it only changes when events do
+func getStableTimestamps() (bool, error) {
+	value := getenv("STABLE_TIMESTAMPS")
+	if value == "" {
+		return false, nil
+	}
+	stable, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("STABLE_TIMESTAMPS must be true or false, got %q", value)
+	}
+	return stable, nil
+}
+
+// getICSPreview reports whether ICS_PREVIEW is set, which leaves tentative
+// events out of calendar.ics and writes every event to calendar-preview.ics
+func getICSPreview() (bool, error) {
+	value := getenv("ICS_PREVIEW")
+	if value == "" {
+		return false, nil
+	}
+	preview, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("ICS_PREVIEW must be true or false, got %q", value)
+	}
+	return preview, nil
+}
+
+// getICSDaySummary returns whether the ICS file has an all-day overview of
+// each day's events, from ICS_DAY_SUMMARY:
+// - "off" (default): only the events themselves
+// - "add": a summary for each day as well as its events
+// - "only": the summaries instead of the events
+func getICSDaySummary() (string, error) {
+	mode := strings.ToLower(getenv("ICS_DAY_SUMMARY"))
+	switch mode {
+	case "":
+		return "off", nil
+	case "off", "add", "only":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("ICS_DAY_SUMMARY must be off, add or only, got %q", mode)
+	}
+}
+
+// writeICSFiles writes calendar.ics for events, sorted chronologically, and with
+// ICS_PREVIEW the preview calendar too, returning the number of events in calendar.ics
+func writeICSFiles(events []Event, clubID string) (int, error) {
+	published := events
+	if validated().icsPreview {
+		published = nil
+		for _, event := range events {
+			if !isTentativeEvent(event) {
+				published = append(published, event)
+			}
+		}
+		if err := writeOutputFile(previewFile, []byte(generateICS(events, clubID))); err != nil {
+			return 0, fmt.Errorf("error saving preview ICS file: %w", err)
+		}
+		log.Printf("Generated %s with %d events, %d of them tentative", outputPath(previewFile), len(events), len(events)-len(published))
+	}
+
+	if err := writeOutputFile(calendarFile, []byte(generateICS(published, clubID))); err != nil {
+		return 0, fmt.Errorf("error saving ICS file: %w", err)
+	}
+
+	if splitBy := validated().icsSplitBy; splitBy != "" {
+		if err := writeSplitICSFiles(published, clubID, splitBy); err != nil {
+			return 0, err
+		}
+	}
+	return len(published), nil
+}
+
+// getICSSplitBy returns how events are also split into one ICS file each, from
+// ICS_SPLIT_BY: "activity", "terrain" or "skill", or "" for no split (the default)
+func getICSSplitBy() (string, error) {
+	splitBy := strings.ToLower(getenv("ICS_SPLIT_BY"))
+	switch splitBy {
+	case "", "activity", "terrain", "skill":
+		return splitBy, nil
+	default:
+		return "", fmt.Errorf("ICS_SPLIT_BY must be activity, terrain or skill, got %q", splitBy)
+	}
+}
+
+// eventPartitions returns the labels of the split ICS files an event belongs
+// in, e.g. "Run" or "Trail", or "Other" when it has no value for splitBy
+// Events for several skill levels are in the file for each, and events
+// without a skill level are in every skill level's file
+func eventPartitions(event Event, splitBy string) []string {
+	var labels []string
+	switch splitBy {
+	case "activity":
+		if event.ActivityType != "" {
+			labels = append(labels, event.ActivityType)
+		}
+	case "terrain":
+		if terrain := getTerrainString(event.Terrain); terrain != "" {
+			labels = append(labels, terrain)
+		}
+	case "skill":
+		if event.SkillLevels == nil || *event.SkillLevels&7 == 0 {
+			return []string{"Beginner", "Intermediate", "Advanced"}
+		}
+		for bit, level := range []string{"Beginner", "Intermediate", "Advanced"} {
+			if *event.SkillLevels&(1<<bit) != 0 {
+				labels = append(labels, level)
+			}
+		}
+	}
+	if len(labels) == 0 {
+		return []string{"Other"}
+	}
+	return labels
+}
+
+// partitionFileName returns the file name for a split ICS file, e.g. "run.ics"
+// for "Run", using only lowercase letters, digits and dashes
+func partitionFileName(label string) string {
+	var name strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(label) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && name.Len() > 0 {
+				name.WriteByte('-')
+			}
+			name.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if name.Len() == 0 {
+		return "other.ics"
+	}
+	return name.String() + ".ics"
+}
+
+// writeSplitICSFiles writes events into one ICS file for each value of
+// splitBy in the calendars directory, e.g. calendars/run.ics and
+// calendars/ride.ics, each named after the calendar and its value. Files
+// left from earlier runs whose value no longer has events are emptied rather
+// than removed, so subscriptions to them keep working
+func writeSplitICSFiles(events []Event, clubID, splitBy string) error {
+	partitions := make(map[string][]Event)
+	labels := make(map[string]string)
+	for _, event := range events {
+		for _, label := range eventPartitions(event, splitBy) {
+			name := partitionFileName(label)
+			partitions[name] = append(partitions[name], event)
+			labels[name] = label
+		}
+	}
+
+	entries, err := os.ReadDir(outputPath(splitCalendarDir))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to list split ICS files: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if _, ok := partitions[name]; !ok && !entry.IsDir() && strings.HasSuffix(name, ".ics") {
+			partitions[name] = nil
+			labels[name] = strings.TrimSuffix(name, ".ics")
+		}
+	}
+
+	names := slices.Sorted(maps.Keys(partitions))
+	for _, name := range names {
+		calendarName := fmt.Sprintf("%s (%s)", getCalendarName(), labels[name])
+		content := generateNamedICS(partitions[name], clubID, calendarName)
+		if err := writeOutputFile(filepath.Join(splitCalendarDir, name), []byte(content)); err != nil {
+			return fmt.Errorf("error saving split ICS file %s: %w", name, err)
+		}
+		log.Printf("Generated %s with %d events", outputPath(filepath.Join(splitCalendarDir, name)), len(partitions[name]))
+	}
+	return nil
+}
+
+// getCalendarName returns the club name shown as the calendar title
+func getCalendarName() string {
+	if name := getenv("ICS_CALENDAR_NAME"); name != "" {
+		return name
+	}
+	return defaultCalendarName
+}
+
+// getCalendarDescription returns the calendar description
+func getCalendarDescription() string {
+	if desc := getenv("ICS_CALENDAR_DESC"); desc != "" {
+		return desc
+	}
+	return defaultCalendarDescription
+}
+
+// getCalendarProdID returns the PRODID identifying the calendar's producer
+func getCalendarProdID() string {
+	if prodID := getenv("ICS_PRODID"); prodID != "" {
+		return prodID
+	}
+	return defaultCalendarProdID
+}
+
+// generateICS creates an iCalendar (ICS) format string from a list of events
+// Output is deterministic for the same events: they are written in order of
+// start time then ID, and with STABLE_TIMESTAMPS no generation time is included
+func generateICS(events []Event, clubID string) string {
+	return generateNamedICS(events, clubID, getCalendarName())
+}
+
+// generateNamedICS is generateICS for a calendar shown as calendarName
+func generateNamedICS(events []Event, clubID string, calendarName string) string {
+	var icsContent strings.Builder
+
+	// A zero generation time leaves it out of the file
+	generatedAt := time.Now()
+	if validated().stableTimestamps {
+		generatedAt = time.Time{}
+	}
+
+	events = slices.Clone(events)
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Start.Equal(events[j].Start) {
+			return events[i].Start.Before(events[j].Start)
+		}
+		return events[i].ID < events[j].ID
+	})
+
+	// ICS header
+	icsContent.WriteString("BEGIN:VCALENDAR\r\n")
+	icsContent.WriteString("VERSION:2.0\r\n")
+	icsContent.WriteString(foldLine("PRODID:"+escapeICSText(getCalendarProdID())) + "\r\n")
+	icsContent.WriteString("CALSCALE:GREGORIAN\r\n")
+	icsContent.WriteString("METHOD:PUBLISH\r\n")
+	icsContent.WriteString(foldLine("X-WR-CALNAME:"+escapeICSText(calendarName)) + "\r\n")
+	icsContent.WriteString(foldLine("X-WR-CALDESC:"+escapeICSText(getCalendarDescription())) + "\r\n")
+
+	// When the calendar was generated, and how often to refresh it (RFC 7986,
+	// with the older X-PUBLISHED-TTL for Outlook and Apple Calendar)
+	if !generatedAt.IsZero() {
+		icsContent.WriteString(fmt.Sprintf("LAST-MODIFIED:%s\r\n", generatedAt.UTC().Format("20060102T150405Z")))
+	}
+	icsContent.WriteString(fmt.Sprintf("REFRESH-INTERVAL;VALUE=DURATION:%s\r\n", icsRefreshInterval))
+	icsContent.WriteString(fmt.Sprintf("X-PUBLISHED-TTL:%s\r\n", icsRefreshInterval))
+
+	// Add a timezone definition for every zone used by the events
+	icsContent.WriteString(generateVTimezones(events))
+
+	alarms := getICSReminders()
+
+	// Group the occurrences of each recurring Strava event, in order of first occurrence
+	occurrences := make(map[int64][]Event)
+	var order []int64
+	for _, event := range events {
+		if _, ok := occurrences[event.ID]; !ok {
+			order = append(order, event.ID)
+		}
+		occurrences[event.ID] = append(occurrences[event.ID], event)
+	}
+
+	daySummary := validated().icsDaySummary
+	if daySummary != "off" {
+		icsContent.WriteString(formatDaySummaries(events, generatedAt))
+	}
+	if daySummary == "only" {
+		order = nil
+	}
+
+	// Add events, as a single VEVENT with an RRULE where occurrences follow a
+	// regular cadence and as separate VEVENTs otherwise
+	for _, id := range order {
+		group := occurrences[id]
+		if rrule, ok := recurrenceRule(group); ok {
+			icsContent.WriteString(formatVEvent(group[0], clubID, fmt.Sprintf("%d@strava.com", id), rrule, alarms, generatedAt))
+			continue
+		}
+		for _, event := range group {
+			icsContent.WriteString(formatVEvent(event, clubID, eventUID(event), "", alarms, generatedAt))
+		}
+	}
+
+	// ICS footer
+	icsContent.WriteString("END:VCALENDAR\r\n")
+
+	return icsContent.String()
+}
+
+// formatDaySummaries creates an all-day VEVENT for each day with events, e.g.
+// "3 club events", listing them in its description. Events are grouped by their
+// local date and must be sorted by start; cancelled events are left out
+// Their UIDs, e.g. day-20250114@strava.com, can't clash with event UIDs, which
+// start with the Strava event ID
+func formatDaySummaries(events []Event, generatedAt time.Time) string {
+	var dates []string
+	days := make(map[string][]Event)
+	for _, event := range events {
+		if event.CancelledAt != nil {
+			continue
+		}
+		date := event.Start.In(eventLocation(event)).Format("20060102")
+		if _, ok := days[date]; !ok {
+			dates = append(dates, date)
+		}
+		days[date] = append(days[date], event)
+	}
+
+	var icsContent strings.Builder
+	for _, date := range dates {
+		dayEvents := days[date]
+		day, _ := time.Parse("20060102", date)
+
+		summary := "1 club event"
+		if len(dayEvents) > 1 {
+			summary = fmt.Sprintf("%d club events", len(dayEvents))
+		}
+		var lines []string
+		for _, event := range dayEvents {
+			when := event.Start.In(eventLocation(event)).Format("3:04 PM")
+			if isAllDayEvent(event) {
+				when = "All day"
+			}
+			line := fmt.Sprintf("%s %s", when, event.Title)
+			if event.Location != "" {
+				line += fmt.Sprintf(" (%s)", event.Location)
+			}
+			lines = append(lines, line+"\n"+event.URL)
+		}
+
+		// Like the events, DTSTAMP is the first start when the file is stable
+		dtstamp := generatedAt
+		if dtstamp.IsZero() {
+			dtstamp = dayEvents[0].Start
+		}
+
+		icsContent.WriteString("BEGIN:VEVENT\r\n")
+		icsContent.WriteString(fmt.Sprintf("UID:day-%s@strava.com\r\n", date))
+		icsContent.WriteString(fmt.Sprintf("DTSTART;VALUE=DATE:%s\r\n", date))
+		icsContent.WriteString(fmt.Sprintf("DTEND;VALUE=DATE:%s\r\n", day.AddDate(0, 0, 1).Format("20060102")))
+		icsContent.WriteString(fmt.Sprintf("DTSTAMP:%s\r\n", dtstamp.UTC().Format("20060102T150405Z")))
+		icsContent.WriteString(foldLine("SUMMARY:"+escapeICSText(summary)) + "\r\n")
+		icsContent.WriteString("STATUS:CONFIRMED\r\n")
+		// An overview shouldn't make the whole day look busy
+		icsContent.WriteString("TRANSP:TRANSPARENT\r\n")
+		icsContent.WriteString(formatICSProperty("DESCRIPTION", strings.Join(lines, "\n\n")))
+		icsContent.WriteString("END:VEVENT\r\n")
+	}
+	return icsContent.String()
+}
+
+// htmlText escapes text for an HTML description, keeping its line breaks
+func htmlText(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+// recurrenceRule returns an RRULE for occurrences of one Strava event when they
+// repeat at a fixed number of days at the same local time, e.g.
+// "FREQ=WEEKLY;INTERVAL=1;UNTIL=20250204T190000Z". ok is false for a single or
+// irregular occurrence, or when any occurrence is cancelled
+// UNTIL is the last occurrence, which is within the sync window, rather than
+// the window end, so clients don't show runs Strava hasn't listed yet
+func recurrenceRule(occurrences []Event) (rrule string, ok bool) {
+	if len(occurrences) < 2 {
+		return "", false
+	}
+
+	location := eventLocation(occurrences[0])
+	first := occurrences[0].Start.In(location)
+	duration := occurrences[0].End.Sub(occurrences[0].Start)
+
+	intervalDays := 0
+	for i, event := range occurrences {
+		if event.CancelledAt != nil || eventLocation(event).String() != location.String() {
+			return "", false
+		}
+		start := event.Start.In(location)
+		if start.Hour() != first.Hour() || start.Minute() != first.Minute() || event.End.Sub(event.Start) != duration {
+			return "", false
+		}
+		if i == 0 {
+			continue
+		}
+
+		// Count calendar days in local time so DST changes don't break the cadence
+		prev := occurrences[i-1].Start.In(location)
+		days := int(time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC).
+			Sub(time.Date(prev.Year(), prev.Month(), prev.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+		if days <= 0 || (intervalDays != 0 && days != intervalDays) {
+			return "", false
+		}
+		intervalDays = days
+	}
+
+	// UNTIL must be in UTC for a DTSTART with a TZID, and a date for all-day events
+	last := occurrences[len(occurrences)-1]
+	until := last.Start.UTC().Format("20060102T150405Z")
+	if isAllDayEvent(last) {
+		until = last.Start.In(location).Format("20060102")
+	}
+
+	if intervalDays%7 == 0 {
+		return fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d;UNTIL=%s", intervalDays/7, until), true
+	}
+	return fmt.Sprintf("FREQ=DAILY;INTERVAL=%d;UNTIL=%s", intervalDays, until), true
+}
+
+// formatVEvent creates the VEVENT for an event, repeating by rrule if set, with
+// a VALARM for each trigger in alarms
+// generatedAt is used for DTSTAMP and the sync time in the description; when
+// zero the sync time is left out and DTSTAMP, which is required, is the start time
+func formatVEvent(event Event, clubID string, uid string, rrule string, alarms []string, generatedAt time.Time) string {
+	var icsContent strings.Builder
+	icsContent.WriteString("BEGIN:VEVENT\r\n")
+
+	// Unique ID
+	icsContent.WriteString(fmt.Sprintf("UID:%s\r\n", uid))
+
+	// Date/time stamps (convert to the event's timezone)
+	location := eventLocation(event)
+	startLocal := event.Start.In(location).Format("20060102T150405")
+	dtstamp := generatedAt
+	if dtstamp.IsZero() {
+		dtstamp = event.Start
+	}
+
+	if isAllDayEvent(event) {
+		// All-day events use dates, with an exclusive end date
+		startDate := event.Start.In(location)
+		icsContent.WriteString(fmt.Sprintf("DTSTART;VALUE=DATE:%s\r\n", startDate.Format("20060102")))
+		icsContent.WriteString(fmt.Sprintf("DTEND;VALUE=DATE:%s\r\n", startDate.AddDate(0, 0, 1).Format("20060102")))
+	} else {
+		icsContent.WriteString(fmt.Sprintf("DTSTART;TZID=%s:%s\r\n", location.String(), startLocal))
+		if hasEndTime(event) {
+			endLocal := event.End.In(location).Format("20060102T150405")
+			icsContent.WriteString(fmt.Sprintf("DTEND;TZID=%s:%s\r\n", location.String(), endLocal))
+		} else {
+			// No end time (END_TIME=none), so say so rather than guess one
+			icsContent.WriteString("DURATION:PT0S\r\n")
+		}
+	}
+	icsContent.WriteString(fmt.Sprintf("DTSTAMP:%s\r\n", dtstamp.UTC().Format("20060102T150405Z")))
+	if rrule != "" {
+		icsContent.WriteString(fmt.Sprintf("RRULE:%s\r\n", rrule))
+	}
+
+	// Event details
+	icsContent.WriteString(foldLine("SUMMARY:"+escapeICSText(calendarEventTitle(event))) + "\r\n")
+
+	// Cancelled events are kept briefly so subscribers see the cancellation,
+	// and marked transparent so they don't block time in free/busy, as are
+	// provisional ones
+	if event.CancelledAt != nil {
+		icsContent.WriteString("STATUS:CANCELLED\r\n")
+		icsContent.WriteString("TRANSP:TRANSPARENT\r\n")
+	} else if isTentativeEvent(event) {
+		icsContent.WriteString("STATUS:TENTATIVE\r\n")
+		icsContent.WriteString("TRANSP:TRANSPARENT\r\n")
+	} else {
+		icsContent.WriteString("STATUS:CONFIRMED\r\n")
+		icsContent.WriteString("TRANSP:OPAQUE\r\n")
+	}
+	if visibility := eventVisibility(event); visibility != "" {
+		icsContent.WriteString(fmt.Sprintf("CLASS:%s\r\n", strings.ToUpper(visibility)))
+	}
+
+	// Description with details including sync timestamp in the default timezone
+	syncTime := ""
+	if !generatedAt.IsZero() {
+		now := generatedAt
+		if loc, err := time.LoadLocation(getDefaultTimezone()); err == nil {
+			now = now.In(loc)
+		}
+		syncTime = now.Format("Mon, 2 Jan @ 3:04 PM")
+	}
+
+	// Name the club the event came from; cached events from older versions don't record one
+	if event.ClubID != "" {
+		clubID = event.ClubID
+	}
+
+	// Build description with structured metadata (same text as Google Calendar)
+	description := buildEventDescription(event, clubID, syncTime)
+	icsContent.WriteString(formatICSProperty("DESCRIPTION", description))
+
+	skillLevel := getSkillLevelString(event.SkillLevels)
+	terrain := getTerrainString(event.Terrain)
+	mapURL := getMapURL(event)
+
+	// Add HTML version for better Google Calendar display
+	// Every value is escaped, since Strava text and URLs may contain markup or quotes
+	htmlParts := []string{}
+	htmlParts = append(htmlParts, fmt.Sprintf("<p><strong>Leader:</strong> %s</p>", htmlText(event.Organizer)))
+
+	if skillLevel != "" {
+		htmlParts = append(htmlParts, fmt.Sprintf("<p><strong>Difficulty:</strong> %s</p>", htmlText(skillLevel)))
+	}
+
+	if terrain != "" {
+		htmlParts = append(htmlParts, fmt.Sprintf("<p><strong>Terrain:</strong> %s</p>", htmlText(terrain)))
+	}
+
+	for _, detail := range formatRouteDetails(event) {
+		label, value, _ := strings.Cut(detail, ": ")
+		htmlParts = append(htmlParts, fmt.Sprintf("<p><strong>%s:</strong> %s</p>", htmlText(label), htmlText(value)))
+	}
+	if event.Attending != nil {
+		htmlParts = append(htmlParts, fmt.Sprintf("<p>%s</p>", htmlText(formatAttending(*event.Attending))))
+	}
+	if duration := formatDurationDetail(event); duration != "" {
+		label, value, _ := strings.Cut(duration, ": ")
+		htmlParts = append(htmlParts, fmt.Sprintf("<p><strong>%s:</strong> %s</p>", htmlText(label), htmlText(value)))
+	}
+
+	if event.Description != "" {
+		htmlParts = append(htmlParts, fmt.Sprintf("<p>%s</p>", htmlText(event.Description)))
+	}
+	if mapURL != "" {
+		htmlParts = append(htmlParts, fmt.Sprintf("<p><strong>Meeting point:</strong> <a href=\"%s\">Open map</a></p>", html.EscapeString(mapURL)))
+	}
+	if event.PhotoURL != "" {
+		htmlParts = append(htmlParts, fmt.Sprintf("<p><img src=\"%s\" alt=\"Cover photo\"></p>", html.EscapeString(event.PhotoURL)))
+	}
+	htmlParts = append(htmlParts, fmt.Sprintf("<p><strong>View on Strava:</strong> <a href=\"%s\">%s</a></p>", html.EscapeString(event.URL), html.EscapeString(event.URL)))
+	if syncTime != "" {
+		htmlParts = append(htmlParts, fmt.Sprintf("<p><strong>Synced from Strava Club %s on:</strong> %s</p>", html.EscapeString(clubID), html.EscapeString(syncTime)))
+	} else {
+		htmlParts = append(htmlParts, fmt.Sprintf("<p><strong>Synced from Strava Club %s</strong></p>", html.EscapeString(clubID)))
+	}
+
+	htmlDescription := strings.Join(htmlParts, "")
+	// Written as is rather than with formatICSProperty, which strips the markup
+	// and would decode the escaped text back into tags
+	icsContent.WriteString(foldLine("X-ALT-DESC;FMTTYPE=text/html:"+escapeICSText(htmlDescription)) + "\r\n")
+
+	// Location
+	if event.Location != "" {
+		icsContent.WriteString(foldLine("LOCATION:"+escapeICSText(event.Location)) + "\r\n")
+	}
+
+	// Geographic position of the meeting point (GEO:lat;lng)
+	if lat, lng, ok := eventCoordinates(event); ok {
+		icsContent.WriteString(fmt.Sprintf("GEO:%f;%f\r\n", lat, lng))
+	}
+
+	// URL
+	icsContent.WriteString(foldLine("URL:"+icsURI(event.URL)) + "\r\n")
+
+	// Cover photo, omitted for events without one
+	if event.PhotoURL != "" {
+		icsContent.WriteString(foldLine("ATTACH;FMTTYPE=image/jpeg:"+icsURI(event.PhotoURL)) + "\r\n")
+	}
+
+	// Categories for filtering in calendar clients, e.g. CATEGORIES:Run,Trail,Beginner
+	if categories := eventCategories(event); len(categories) > 0 {
+		for i, category := range categories {
+			categories[i] = escapeICSText(category)
+		}
+		icsContent.WriteString(foldLine("CATEGORIES:"+strings.Join(categories, ",")) + "\r\n")
+	}
+
+	// One display alarm per ICS_REMINDERS trigger, none for cancelled events
+	if event.CancelledAt == nil {
+		for _, trigger := range alarms {
+			icsContent.WriteString("BEGIN:VALARM\r\n")
+			icsContent.WriteString("ACTION:DISPLAY\r\n")
+			icsContent.WriteString(foldLine("DESCRIPTION:"+escapeICSText(event.Title)) + "\r\n")
+			icsContent.WriteString(fmt.Sprintf("TRIGGER:%s\r\n", trigger))
+			icsContent.WriteString("END:VALARM\r\n")
+		}
+	}
+
+	icsContent.WriteString("END:VEVENT\r\n")
+
+	return icsContent.String()
+}
+
+// eventCategories returns the activity type, terrain, each skill level and the
+// title tags of an event, leaving out any that are unknown
+func eventCategories(event Event) []string {
+	var categories []string
+	if event.ActivityType != "" {
+		categories = append(categories, event.ActivityType)
+	}
+	if terrain := getTerrainString(event.Terrain); terrain != "" {
+		categories = append(categories, terrain)
+	}
+	if skillLevel := getSkillLevelString(event.SkillLevels); skillLevel != "" {
+		categories = append(categories, strings.Split(skillLevel, ", ")...)
+	}
+	for _, tag := range eventTags(event) {
+		if !slices.Contains(categories, tag) {
+			categories = append(categories, tag)
+		}
+	}
+	return categories
+}
+
+// generateVTimezones builds a VTIMEZONE block for each distinct zone used by events
+func generateVTimezones(events []Event) string {
+	// Find the span of dates each zone needs to cover
+	type span struct {
+		location   *time.Location
+		start, end time.Time
+	}
+	spans := make(map[string]*span)
+	var zones []string
+	for _, event := range events {
+		location := eventLocation(event)
+		name := location.String()
+		sp, ok := spans[name]
+		if !ok {
+			sp = &span{location: location, start: event.Start, end: event.End}
+			spans[name] = sp
+			zones = append(zones, name)
+		}
+		if event.Start.Before(sp.start) {
+			sp.start = event.Start
+		}
+		if event.End.After(sp.end) {
+			sp.end = event.End
+		}
+	}
+	sort.Strings(zones)
+
+	var result strings.Builder
+	for _, name := range zones {
+		sp := spans[name]
+		result.WriteString(generateVTimezone(sp.location, sp.start, sp.end))
+	}
+	return result.String()
+}
+
+// generateVTimezone builds a VTIMEZONE block for location covering start to end
+// Go doesn't expose the tz database rules, so rather than an RRULE each offset
+// transition in the period is emitted as its own observance
+func generateVTimezone(location *time.Location, start, end time.Time) string {
+	var result strings.Builder
+	result.WriteString("BEGIN:VTIMEZONE\r\n")
+	result.WriteString(fmt.Sprintf("TZID:%s\r\n", location.String()))
+
+	// The observance already in effect at the start of the period
+	periodStart, periodEnd := start.In(location).ZoneBounds()
+	if periodStart.IsZero() {
+		// No transitions before start (e.g. zones without DST), so the
+		// observance applies from the beginning of time
+		_, offset := start.In(location).Zone()
+		epoch := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).In(location)
+		result.WriteString(formatObservance(start.In(location), epoch.Format("20060102T150405"), offset))
+	} else {
+		_, offsetFrom := periodStart.Add(-time.Second).Zone()
+		result.WriteString(formatObservance(periodStart, localTransitionTime(periodStart, offsetFrom), offsetFrom))
+	}
+
+	// Every transition up to the end of the period
+	for !periodEnd.IsZero() && !periodEnd.After(end) {
+		_, offsetFrom := periodEnd.Add(-time.Second).Zone()
+		result.WriteString(formatObservance(periodEnd, localTransitionTime(periodEnd, offsetFrom), offsetFrom))
+		_, periodEnd = periodEnd.ZoneBounds()
+	}
+
+	result.WriteString("END:VTIMEZONE\r\n")
+	return result.String()
+}
+
+// formatObservance formats a STANDARD or DAYLIGHT sub-component for the zone in effect at t
+func formatObservance(t time.Time, dtstart string, offsetFrom int) string {
+	name, offsetTo := t.Zone()
+	kind := "STANDARD"
+	if t.IsDST() {
+		kind = "DAYLIGHT"
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("BEGIN:%s\r\n", kind))
+	result.WriteString(fmt.Sprintf("DTSTART:%s\r\n", dtstart))
+	result.WriteString(fmt.Sprintf("TZOFFSETFROM:%s\r\n", formatUTCOffset(offsetFrom)))
+	result.WriteString(fmt.Sprintf("TZOFFSETTO:%s\r\n", formatUTCOffset(offsetTo)))
+	result.WriteString(fmt.Sprintf("TZNAME:%s\r\n", name))
+	result.WriteString(fmt.Sprintf("END:%s\r\n", kind))
+	return result.String()
+}
+
+// localTransitionTime formats a transition instant as local time in the offset
+// before the transition, which is how RFC 5545 expects observance DTSTARTs
+func localTransitionTime(t time.Time, offsetFrom int) string {
+	return t.In(time.FixedZone("", offsetFrom)).Format("20060102T150405")
+}
+
+// formatUTCOffset formats an offset in seconds as an RFC 5545 UTC offset (e.g. +0100, -0500)
+func formatUTCOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, (seconds%3600)/60)
+}
+
+// stripHTML removes HTML tags from text for Apple Calendar compatibility
+func stripHTML(input string) string {
+	// Remove HTML tags
+	re := regexp.MustCompile(`<[^>]*>`)
+	text := re.ReplaceAllString(input, "")
+
+	return decodeHTMLEntities(text)
+}
+
+// escapeICSText escapes special characters per RFC 5545 for Apple Calendar compatibility
+func escapeICSText(s string) string {
+	s = normalizeICSText(s)
+
+	// Must escape in this order to avoid double-escaping
+	s = strings.ReplaceAll(s, "\\", "\\\\") // Backslash must be first
+	s = strings.ReplaceAll(s, ";", "\\;")   // Semicolon
+	s = strings.ReplaceAll(s, ",", "\\,")   // Comma
+	s = strings.ReplaceAll(s, "\n", "\\n")  // LF to literal \n
+	return s
+}
+
+// unescapeICSText reverses escapeICSText, for text read back from a calendar
+func unescapeICSText(s string) string {
+	var text strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' || s[i] == 'N' {
+				text.WriteByte('\n')
+			} else {
+				text.WriteByte(s[i])
+			}
+			continue
+		}
+		text.WriteByte(s[i])
+	}
+	return text.String()
+}
+
+// normalizeICSText turns every line ending in text written by club members,
+// e.g. Windows "\r\n", old Mac "\r" and Unicode line and paragraph separators,
+// into "\n", and drops the other control characters RFC 5545 doesn't allow in
+// text (tabs are kept), so nothing can break a content line when written
+func normalizeICSText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\r' || r == '\u2028' || r == '\u2029':
+			return '\n'
+		case r == '\n' || r == '\t':
+			return r
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// icsURI returns a URI value with any control characters removed, since URIs
+// aren't escaped like text
+func icsURI(uri string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, uri)
+}
+
+// foldLine wraps long lines per RFC 5545 (max 75 octets per line)
+// Apple Calendar strictly requires this for proper display
+func foldLine(text string) string {
+	const maxLen = 75
+
+	if len(text) <= maxLen {
+		return text
+	}
+
+	// The first line holds maxLen octets and continuation lines one fewer, since
+	// the leading space counts. Lines are never split inside a UTF-8 character
+	var result strings.Builder
+	limit := maxLen
+	for len(text) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		result.WriteString(text[:cut])
+		result.WriteString("\r\n ") // Continuation: CRLF + space
+		text = text[cut:]
+		limit = maxLen - 1
+	}
+	result.WriteString(text)
+
+	return result.String()
+}
+
+// formatICSProperty formats a property with proper escaping and line folding for Apple Calendar
+func formatICSProperty(property, value string) string {
+	// Strip HTML for Apple Calendar compatibility
+	cleaned := stripHTML(value)
+	// Escape special characters per RFC 5545
+	escaped := escapeICSText(cleaned)
+	// Combine property name and value
+	line := property + ":" + escaped
+	// Fold long lines (max 75 octets)
+	folded := foldLine(line)
+	return folded + "\r\n"
+}
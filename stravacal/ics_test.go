@@ -0,0 +1,240 @@
+package stravacal
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestGenerateICSHeader(t *testing.T) {
+	withSettings(t, map[string]string{
+		"ICS_CALENDAR_NAME": "Runners; Walkers, Friends",
+		"ICS_CALENDAR_DESC": `Runs\Rides`,
+		"ICS_PRODID":        "-//Example Club//Events//EN",
+	})
+
+	ics := generateICS(nil, "123")
+	for _, want := range []string{
+		`X-WR-CALNAME:Runners\; Walkers\, Friends` + "\r\n",
+		`X-WR-CALDESC:Runs\\Rides` + "\r\n",
+		"PRODID:-//Example Club//Events//EN\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("ICS header is missing %q:\n%s", want, ics)
+		}
+	}
+}
+
+func TestGenerateICSRecurrenceEndsWithinWindow(t *testing.T) {
+	withSettings(t, nil)
+
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	const windowDays = 30
+	now := time.Now()
+	windowEnd := now.AddDate(0, 0, windowDays)
+
+	// Ten weekly runs, of which only those before the window end are listed
+	tomorrow := now.In(london).AddDate(0, 0, 1)
+	first := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 18, 30, 0, 0, london)
+	var events []Event
+	for week := range 10 {
+		event := testEvent(1, first.AddDate(0, 0, 7*week))
+		event.Zone = "Europe/London"
+		events = append(events, event)
+	}
+	events = filterEventsInWindow(events, windowDays)
+	last := events[len(events)-1].Start
+
+	ics := generateICS(events, "123")
+	match := regexp.MustCompile(`RRULE:FREQ=WEEKLY;INTERVAL=1;UNTIL=(\d{8}T\d{6}Z)`).FindStringSubmatch(ics)
+	if match == nil {
+		t.Fatalf("ICS has no weekly RRULE:\n%s", ics)
+	}
+	until, err := time.Parse("20060102T150405Z", match[1])
+	if err != nil {
+		t.Fatalf("UNTIL %q isn't a UTC time: %v", match[1], err)
+	}
+	if until.After(windowEnd) {
+		t.Errorf("UNTIL = %v, after the window end %v", until, windowEnd.UTC())
+	}
+	if !until.Equal(last) {
+		t.Errorf("UNTIL = %v, want the last listed run %v", until, last.UTC())
+	}
+}
+
+func TestFormatICSPropertyLineEndings(t *testing.T) {
+	description := "Meet at the gate.\r\nBring a head torch,\r\nand water; it's 10 km.\rOld Mac line\u2028and a separator " +
+		strings.Repeat("long text ", 20)
+	want := "Meet at the gate.\nBring a head torch,\nand water; it's 10 km.\nOld Mac line\nand a separator " +
+		strings.Repeat("long text ", 20)
+
+	property := formatICSProperty("DESCRIPTION", description)
+	if problems := validateICS("BEGIN:VCALENDAR\r\n" + property + "END:VCALENDAR\r\n"); len(problems) > 0 {
+		t.Errorf("DESCRIPTION isn't valid: %q", problems)
+	}
+
+	// Every line break is escaped, so unfolding leaves one content line
+	unfolded := strings.ReplaceAll(strings.TrimSuffix(property, "\r\n"), "\r\n ", "")
+	if strings.ContainsAny(unfolded, "\r\n") {
+		t.Fatalf("unfolded DESCRIPTION has a stray line break: %q", unfolded)
+	}
+	value, ok := strings.CutPrefix(unfolded, "DESCRIPTION:")
+	if !ok {
+		t.Fatalf("unfolded DESCRIPTION = %q", unfolded)
+	}
+	if got := unescapeICSText(value); got != want {
+		t.Errorf("reimported DESCRIPTION = %q, want %q", got, want)
+	}
+}
+
+func TestGenerateICSEscapesHTMLDescription(t *testing.T) {
+	withSettings(t, nil)
+
+	event := testEvent(1, time.Date(2030, 7, 2, 17, 30, 0, 0, time.UTC))
+	event.Description = `Bring "kit" <b>& water</b>`
+	event.Organizer = `Sam "Speedy" <Smith> & Co`
+	event.URL = `https://www.strava.com/clubs/123/group_events/1?a="b"&c=<d>`
+
+	ics := strings.ReplaceAll(generateICS([]Event{event}, "123"), "\r\n ", "")
+	var altDesc string
+	for _, line := range strings.Split(ics, "\r\n") {
+		if value, ok := strings.CutPrefix(line, "X-ALT-DESC;FMTTYPE=text/html:"); ok {
+			altDesc = unescapeICSText(value)
+		}
+	}
+	if altDesc == "" {
+		t.Fatalf("no X-ALT-DESC in:\n%s", ics)
+	}
+
+	for _, want := range []string{
+		"Bring &#34;kit&#34; &lt;b&gt;&amp; water&lt;/b&gt;",
+		"Sam &#34;Speedy&#34; &lt;Smith&gt; &amp; Co",
+		`<a href="https://www.strava.com/clubs/123/group_events/1?a=&#34;b&#34;&amp;c=&lt;d&gt;">`,
+	} {
+		if !strings.Contains(altDesc, want) {
+			t.Errorf("X-ALT-DESC is missing %q:\n%s", want, altDesc)
+		}
+	}
+	for _, unwanted := range []string{"<b>", "<Smith>", `"kit"`} {
+		if strings.Contains(altDesc, unwanted) {
+			t.Errorf("X-ALT-DESC has unescaped %q:\n%s", unwanted, altDesc)
+		}
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "Tuesday Tempo", "Tuesday Tempo"},
+		{"semicolon", "Run; walk", `Run\; walk`},
+		{"comma", "Run, walk", `Run\, walk`},
+		{"newline", "Run\nwalk", `Run\nwalk`},
+		{"CRLF", "Run\r\nwalk", `Run\nwalk`},
+		// Backslashes are escaped first, so the escapes added after aren't doubled
+		{"backslash", `C:\runs`, `C:\\runs`},
+		{"backslash before semicolon", `a\;b`, `a\\\;b`},
+		{"backslash before comma", `a\,b`, `a\\\,b`},
+		{"backslash before newline", "a\\\nb", `a\\\nb`},
+		{"literal backslash n", `a\nb`, `a\\nb`},
+		{"control characters dropped", "a\x00b\x07c\td", "abc\td"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := escapeICSText(tt.in)
+			if got != tt.want {
+				t.Errorf("escapeICSText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			// Text that needed no normalizing reads back as it was
+			if back := unescapeICSText(got); normalizeICSText(tt.in) == tt.in && back != tt.in {
+				t.Errorf("unescapeICSText(%q) = %q, want %q", got, back, tt.in)
+			}
+		})
+	}
+}
+
+func TestStripHTML(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Plain text", "Plain text"},
+		{"<p>Meet at the <b>gate</b></p>", "Meet at the gate"},
+		{`<a href="https://example.com">Route</a>`, "Route"},
+		{"Fish &amp; chips after", "Fish & chips after"},
+		{"&lt;b&gt; isn't a tag", "<b> isn't a tag"},
+		{"It&#39;s 5&nbsp;km", "It's 5 km"},
+		{"<br/>Line&#x27;s end<br>", "Line's end"},
+	}
+	for _, tt := range tests {
+		if got := stripHTML(tt.in); got != tt.want {
+			t.Errorf("stripHTML(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFoldLine(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string // The folded lines, without CRLF and the leading space
+	}{
+		{"short", "SUMMARY:Run", []string{"SUMMARY:Run"}},
+		{"exactly 75 octets", strings.Repeat("a", 75), []string{strings.Repeat("a", 75)}},
+		{"76 octets", strings.Repeat("a", 76), []string{strings.Repeat("a", 75), "a"}},
+		{"continuations hold 74 octets", strings.Repeat("a", 75+74+1), []string{strings.Repeat("a", 75), strings.Repeat("a", 74), "a"}},
+		// "é" is 2 octets, and a 3-octet "€" would straddle octet 75
+		{"two-octet runes", strings.Repeat("é", 40), []string{strings.Repeat("é", 37), strings.Repeat("é", 3)}},
+		{"rune across the limit", strings.Repeat("a", 73) + "€b", []string{strings.Repeat("a", 73), "€b"}},
+		{"emoji", strings.Repeat("🏃", 20), []string{strings.Repeat("🏃", 18), strings.Repeat("🏃", 2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := foldLine(tt.in)
+			if want := strings.Join(tt.want, "\r\n "); got != want {
+				t.Errorf("foldLine(%q) =\n%q\nwant\n%q", tt.in, got, want)
+			}
+			for i, line := range strings.Split(got, "\r\n") {
+				if len(line) > 75 {
+					t.Errorf("line %d is %d octets", i+1, len(line))
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d splits a character: %q", i+1, line)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatICSProperty(t *testing.T) {
+	tests := []struct {
+		name     string
+		property string
+		value    string
+		want     string
+	}{
+		{"plain", "SUMMARY", "Tuesday Tempo", "SUMMARY:Tuesday Tempo\r\n"},
+		{"escaped", "LOCATION", "Gate 2, Park; North", `LOCATION:Gate 2\, Park\; North` + "\r\n"},
+		// Entities are decoded before escaping, so a decoded "," or ";" is escaped too
+		{"HTML", "DESCRIPTION", "<p>Fish &amp; chips,</p><br>see&#59; you", `DESCRIPTION:Fish & chips\,see\; you` + "\r\n"},
+		{"newlines", "DESCRIPTION", "Line 1\r\nLine 2", `DESCRIPTION:Line 1\nLine 2` + "\r\n"},
+		{
+			"folded", "DESCRIPTION", strings.Repeat("run, ", 20),
+			"DESCRIPTION:" + strings.Repeat(`run\, `, 10) + "run\r\n " + `\, ` + strings.Repeat(`run\, `, 9) + "\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatICSProperty(tt.property, tt.value); got != tt.want {
+				t.Errorf("formatICSProperty(%q, %q) =\n%q\nwant\n%q", tt.property, tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package stravacal
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// requiredVEventProperties must appear in every VEVENT we publish
+// An end is also required, as either DTEND or DURATION (see END_TIME)
+var requiredVEventProperties = []string{"UID", "DTSTART", "DTSTAMP"}
+
+// validateICS runs structural RFC 5545 checks on an ICS file and returns a
+// description of each violation found:
+// - every line ends in CRLF
+// - no line is longer than 75 octets
+// - BEGIN/END blocks are balanced and properly nested
+// - every VEVENT has UID, DTSTART, DTSTAMP and DTEND or DURATION
+func validateICS(content string) []string {
+	var violations []string
+
+	if !strings.HasSuffix(content, "\r\n") {
+		violations = append(violations, "file does not end with CRLF")
+	}
+	lines := strings.Split(strings.TrimSuffix(content, "\r\n"), "\r\n")
+
+	var blocks []string
+	var eventProperties map[string]bool
+	eventStart := 0
+
+	for i, line := range lines {
+		lineNumber := i + 1
+
+		if strings.ContainsAny(line, "\r\n") {
+			violations = append(violations, fmt.Sprintf("line %d: line break without CRLF", lineNumber))
+		}
+		if len(line) > 75 {
+			violations = append(violations, fmt.Sprintf("line %d: %d octets, longer than 75", lineNumber, len(line)))
+		}
+
+		// Continuation lines belong to the property above
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+
+		// Property name is everything before the first ';' or ':'
+		name := line
+		if idx := strings.IndexAny(line, ";:"); idx >= 0 {
+			name = line[:idx]
+		}
+		value := ""
+		if idx := strings.Index(line, ":"); idx >= 0 {
+			value = line[idx+1:]
+		}
+
+		switch name {
+		case "BEGIN":
+			blocks = append(blocks, value)
+			if value == "VEVENT" {
+				eventProperties = make(map[string]bool)
+				eventStart = lineNumber
+			}
+		case "END":
+			if len(blocks) == 0 {
+				violations = append(violations, fmt.Sprintf("line %d: END:%s without BEGIN", lineNumber, value))
+				continue
+			}
+			if open := blocks[len(blocks)-1]; open != value {
+				violations = append(violations, fmt.Sprintf("line %d: END:%s closes BEGIN:%s", lineNumber, value, open))
+			}
+			blocks = blocks[:len(blocks)-1]
+
+			if value == "VEVENT" && eventProperties != nil {
+				for _, property := range requiredVEventProperties {
+					if !eventProperties[property] {
+						violations = append(violations, fmt.Sprintf("line %d: VEVENT is missing %s", eventStart, property))
+					}
+				}
+				if !eventProperties["DTEND"] && !eventProperties["DURATION"] {
+					violations = append(violations, fmt.Sprintf("line %d: VEVENT is missing DTEND or DURATION", eventStart))
+				}
+				eventProperties = nil
+			}
+		default:
+			if eventProperties != nil && len(blocks) > 0 && blocks[len(blocks)-1] == "VEVENT" {
+				eventProperties[name] = true
+			}
+		}
+	}
+
+	for _, open := range blocks {
+		violations = append(violations, fmt.Sprintf("BEGIN:%s is never closed", open))
+	}
+
+	return violations
+}
+
+// validateICSFile generates the ICS file content from cached events, the same
+// way the ics command does, and reports any RFC 5545 violations
+func validateICSFile(windowDays int, clubID string) error {
+	log.Println("Validating ICS generated from cached events...")
+
+	events, err := loadExistingEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load existing events: %w", err)
+	}
+
+	filteredEvents := filterEventsInWindow(events, windowDays)
+	sort.Slice(filteredEvents, func(i, j int) bool {
+		return filteredEvents[i].Start.Before(filteredEvents[j].Start)
+	})
+
+	content := generateICS(filteredEvents, clubID)
+	violations := validateICS(content)
+
+	fmt.Printf("Checked %d events, %d lines\n", len(filteredEvents), strings.Count(content, "\r\n"))
+	if len(violations) == 0 {
+		fmt.Println("✓ No violations found")
+		return nil
+	}
+
+	for _, violation := range violations {
+		fmt.Printf("  ✗ %s\n", violation)
+	}
+	return fmt.Errorf("generated ICS has %d RFC 5545 violations", len(violations))
+}
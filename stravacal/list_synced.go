@@ -0,0 +1,121 @@
+package stravacal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// listSyncedEvents prints every event on GOOGLE_CALENDAR_ID created by this
+// tool, whatever its date, with its Google event ID, start,
+// title and whether the occurrence is still on Strava. Every page of the
+// calendar is listed, so events the sync window never sees are found too
+// Nothing is changed
+func listSyncedEvents(ctx context.Context) error {
+	now := time.Now()
+
+	// Fetched first so a Strava failure doesn't waste a calendar listing
+	tokens, err := loadTokens()
+	if err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+	clubIDs := validated().clubIDs
+	log.Println("Fetching club events from Strava API...")
+	clubEvents, err := fetchClubsEvents(ctx, tokens, clubIDs, true)
+	if clubEvents == nil {
+		return fmt.Errorf("failed to fetch events from API: %w", err)
+	} else if err != nil {
+		// Events of the clubs that failed would all show as missing
+		return fmt.Errorf("failed to fetch every club, so presence on Strava can't be checked: %w", err)
+	}
+	onStrava := make(map[string]Event)
+	for _, id := range clubIDs {
+		for _, se := range clubEvents[id] {
+			occurrences, err := convertStravaEvent(se, id)
+			if err != nil {
+				continue
+			}
+			for _, event := range occurrences {
+				onStrava[eventUID(event)] = event
+			}
+		}
+	}
+
+	calendarID := getenv("GOOGLE_CALENDAR_ID")
+	log.Println("Authenticating with Google Calendar...")
+	srv, err := getCalendarService()
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with Google Calendar: %w", err)
+	}
+	// A cache entry lists the whole calendar, following every page
+	entry := &calendarCacheEntry{events: make(map[string]*calendar.Event)}
+	if err := entry.fetch(ctx, srv, calendarID); err != nil {
+		return fmt.Errorf("unable to list calendar events: %w", err)
+	}
+
+	var synced []*calendar.Event
+	for _, gcalEvent := range entry.events {
+		if _, managed := managedEventUID(gcalEvent); managed {
+			synced = append(synced, gcalEvent)
+		}
+	}
+	sort.Slice(synced, func(i, j int) bool {
+		start, _ := parseEventDateTime(synced[i].Start)
+		otherStart, _ := parseEventDateTime(synced[j].Start)
+		if !start.Equal(otherStart) {
+			return start.Before(otherStart)
+		}
+		return synced[i].Id < synced[j].Id
+	})
+
+	fmt.Printf("Google Calendar (%s): %d events synced from Strava\n\n", calendarID, len(synced))
+	missing := 0
+	for _, gcalEvent := range synced {
+		status := syncedEventStatus(gcalEvent, onStrava, now)
+		if strings.HasPrefix(status, "missing") {
+			missing++
+		}
+		fmt.Printf("%s  %s  %s\n    %s\n", gcalEvent.Id, formatCalendarEventStart(gcalEvent), gcalEvent.Summary, status)
+	}
+
+	fmt.Printf("\n%d of %d events are missing from Strava\n", missing, len(synced))
+	return nil
+}
+
+// formatCalendarEventStart returns a calendar event's start for listings, e.g.
+// "Tue 14 Jan 2025 19:00" or "Tue 14 Jan 2025 all day"
+func formatCalendarEventStart(gcalEvent *calendar.Event) string {
+	t, ok := parseEventDateTime(gcalEvent.Start)
+	if !ok {
+		return "unknown start"
+	}
+	if gcalEvent.Start.DateTime == "" {
+		return t.Format("Mon 2 Jan 2006") + " all day"
+	}
+	return t.Format("Mon 2 Jan 2006 15:04")
+}
+
+// syncedEventStatus describes whether a calendar event's Strava occurrence is
+// still there. Strava only lists upcoming occurrences, so finished events are
+// reported as past rather than missing
+func syncedEventStatus(gcalEvent *calendar.Event, onStrava map[string]Event, now time.Time) string {
+	uid, _ := managedEventUID(gcalEvent)
+	if event, ok := onStrava[uid]; ok {
+		if reason := exclusionReason(event); reason != "" {
+			return "on Strava, but left out: " + reason
+		}
+		return "on Strava"
+	}
+	if end, ok := parseEventDateTime(gcalEvent.End); ok && end.Before(now) {
+		return "past (Strava no longer lists it)"
+	}
+	if !strings.Contains(uid, "-") {
+		return "missing from Strava (older <id>@strava.com UID)"
+	}
+	return "missing from Strava"
+}
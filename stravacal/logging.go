@@ -0,0 +1,48 @@
+package stravacal
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logLevel is the configured log level, so output printed outside the logger,
+// like the per-event lines of the sync summary, can be quiet too
+var logLevel = slog.LevelInfo
+
+// setupLogging configures log output from environment variables
+// - LOG_FORMAT: "text" (default, human readable) or "json" (one object per line)
+// - LOG_LEVEL: DEBUG, INFO (default), WARN or ERROR (--verbose and --quiet set
+// DEBUG and ERROR)
+//
+// Plain log.Printf calls are routed through the same handler at INFO level,
+// so existing progress messages appear in JSON output too, and are left out
+// above INFO
+func setupLogging() error {
+	level := slog.LevelInfo
+	if value := getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("LOG_LEVEL must be DEBUG, INFO, WARN or ERROR, got %q", value)
+		}
+	}
+	logLevel = level
+
+	switch format := strings.ToLower(getenv("LOG_FORMAT")); format {
+	case "", "text":
+		if level > slog.LevelInfo {
+			// The standard log output can't filter log.Printf, so use a handler
+			// that can, which only writes the warnings and errors
+			slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+			break
+		}
+		// Keep the standard log output and only filter slog records by level
+		slog.SetLogLoggerLevel(level)
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	default:
+		return fmt.Errorf("LOG_FORMAT must be text or json, got %q", format)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package stravacal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// notifyTimeout keeps a slow or failing webhook from holding up the run
+	notifyTimeout = 10 * time.Second
+
+	// maxNotifyChanges caps the changes listed in one message, since Discord
+	// rejects messages over 2000 characters
+	maxNotifyChanges = 20
+)
+
+// notifySyncChanges posts one message summarizing a sync's changes to
+// SLACK_WEBHOOK_URL and NOTIFY_WEBHOOK_URL, whichever are set. Nothing is posted
+// when the sync changed nothing, and failures are only logged
+func notifySyncChanges(report *SyncReport) {
+	slackURL := getenv("SLACK_WEBHOOK_URL")
+	webhookURL := getenv("NOTIFY_WEBHOOK_URL")
+	if (slackURL == "" && webhookURL == "") || report == nil || report.DryRun {
+		return
+	}
+
+	message := formatSyncNotification(report)
+	if message == "" {
+		slog.Debug("No calendar changes to notify")
+		return
+	}
+
+	if slackURL != "" {
+		postWebhook("Slack", slackURL, map[string]string{"text": message})
+	}
+	if webhookURL != "" {
+		// "text" is read by Slack-compatible services and "content" by Discord
+		postWebhook("notification", webhookURL, map[string]string{"text": message, "content": message})
+	}
+}
+
+// formatSyncNotification returns a readable summary of a sync's changes, e.g.
+// "Calendar updated: 1 created, 2 updated" followed by a line per change, or
+// "" if nothing changed
+func formatSyncNotification(report *SyncReport) string {
+	labels := map[string]string{"create": "Added", "update": "Updated", "adopt": "Adopted", "delete": "Removed"}
+
+	var lines []string
+	for _, outcome := range report.Events {
+		label, ok := labels[outcome.Action]
+		if !ok || outcome.Error != "" {
+			continue
+		}
+		line := fmt.Sprintf("• %s: %s", label, outcome.Title)
+		if len(outcome.Changes) > 0 {
+			line += fmt.Sprintf(" (%s changed)", strings.Join(outcome.Changes, ", "))
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	if len(lines) > maxNotifyChanges {
+		more := len(lines) - maxNotifyChanges
+		lines = append(lines[:maxNotifyChanges], fmt.Sprintf("…and %d more", more))
+	}
+
+	summary := fmt.Sprintf("%s calendar updated: %d created, %d updated, %d deleted",
+		getCalendarName(), report.Created, report.Updated, report.Deleted)
+	if report.Failed > 0 {
+		summary += fmt.Sprintf(", %d failed", report.Failed)
+	}
+	return summary + "\n" + strings.Join(lines, "\n")
+}
+
+// postWebhook posts payload as JSON to a webhook, logging any failure
+func postWebhook(name, url string, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Warn("Failed to encode webhook message", "webhook", name, "error", err)
+		return
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("Failed to post webhook", "webhook", name, "error", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		slog.Warn("Webhook rejected", "webhook", name, "http_status", resp.StatusCode)
+		return
+	}
+	slog.Debug("Posted webhook", "webhook", name)
+}
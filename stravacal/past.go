@@ -0,0 +1,88 @@
+package stravacal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// pastEventsFile holds the occurrences found by the past command, relative to OUTPUT_DIR
+const pastEventsFile = "past/events.json"
+
+// defaultPastDays is how far back the past command looks without --from
+const defaultPastDays = 30
+
+// fetchPastEvents fetches club events without upcoming=true, so ones that have
+// already happened are included, and saves the occurrences starting in [from, to)
+// to output/past/events.json, e.g. for an attendance report
+// from defaults to defaultPastDays ago and to to now. Strava dates events by their
+// upcoming occurrences, so events it returns without any are counted as undated
+// The sync's cache and calendars are left alone
+func fetchPastEvents(ctx context.Context, from, to time.Time) error {
+	now := time.Now()
+	if from.IsZero() {
+		from = now.AddDate(0, 0, -defaultPastDays)
+	}
+	if to.IsZero() {
+		to = now
+	}
+	log.Printf("Fetching club events from %s to %s...", from.Format(dateRangeLayout), to.Add(-time.Second).Format(dateRangeLayout))
+
+	tokens, err := loadTokens()
+	if err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+
+	clubIDs := validated().clubIDs
+	clubEvents, err := fetchClubsEvents(ctx, tokens, clubIDs, false)
+	if clubEvents == nil {
+		return &TemporaryError{Err: fmt.Errorf("failed to fetch events from API: %w", err)}
+	} else if err != nil {
+		log.Printf("Warning: continuing without some clubs: %v", err)
+	}
+
+	var events []Event
+	undated := 0
+	for _, clubID := range clubIDs {
+		for _, se := range clubEvents[clubID] {
+			if len(se.UpcomingOccurrences) == 0 {
+				undated++
+				continue
+			}
+			occurrences, err := convertStravaEvent(se, clubID)
+			if err != nil {
+				log.Printf("Failed to convert event %d: %v", se.ID, err)
+				continue
+			}
+			for _, event := range occurrences {
+				if event.Start.Before(from) || !event.Start.Before(to) || !includeEvent(event) {
+					continue
+				}
+				events = append(events, event)
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal past events: %w", err)
+	}
+	if err := writeOutputFile(pastEventsFile, data); err != nil {
+		return fmt.Errorf("failed to write past events: %w", err)
+	}
+
+	for _, event := range events {
+		fmt.Printf("%s  %s\n", formatExplainStart(event), event.Title)
+	}
+	if undated > 0 {
+		log.Printf("%d events had no dated occurrences and were left out", undated)
+	}
+	log.Printf("Saved %d occurrences to %s", len(events), outputPath(pastEventsFile))
+	return nil
+}
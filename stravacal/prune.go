@@ -0,0 +1,102 @@
+package stravacal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"sort"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// parsePruneArgs returns whether prune deletes events, from "--confirm"
+// Without it, or with "--dry-run", events are only listed
+func parsePruneArgs(args []string) (bool, error) {
+	confirm := false
+	for _, arg := range args {
+		switch arg {
+		case "--confirm":
+			confirm = true
+		case "--dry-run":
+		default:
+			return false, fmt.Errorf("usage: prune [--dry-run | --confirm]")
+		}
+	}
+	return confirm, nil
+}
+
+// pruneCalendar removes every event this tool created from GOOGLE_CALENDAR_ID,
+// whatever its date, leaving events added by hand alone. Events are found by
+// their extended properties or @strava.com iCalUID, following every page of
+// the calendar. Unless confirm is set they are only listed
+func pruneCalendar(ctx context.Context, confirm bool) error {
+	calendarID := getenv("GOOGLE_CALENDAR_ID")
+	log.Println("Authenticating with Google Calendar...")
+	srv, err := getCalendarService()
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with Google Calendar: %w", err)
+	}
+	if confirm {
+		if err := checkCalendarAccess(ctx, srv, calendarID); err != nil {
+			return err
+		}
+	}
+
+	entry := &calendarCacheEntry{events: make(map[string]*calendar.Event)}
+	if err := entry.fetch(ctx, srv, calendarID); err != nil {
+		return fmt.Errorf("unable to list calendar events: %w", err)
+	}
+
+	var managed []*calendar.Event
+	for _, gcalEvent := range entry.events {
+		if _, ok := managedEventUID(gcalEvent); ok {
+			managed = append(managed, gcalEvent)
+		}
+	}
+	sort.Slice(managed, func(i, j int) bool {
+		start, _ := parseEventDateTime(managed[i].Start)
+		otherStart, _ := parseEventDateTime(managed[j].Start)
+		if !start.Equal(otherStart) {
+			return start.Before(otherStart)
+		}
+		return managed[i].Id < managed[j].Id
+	})
+
+	fmt.Printf("Google Calendar (%s): %d events created by this tool, %d others left alone\n\n",
+		calendarID, len(managed), len(entry.events)-len(managed))
+	for _, gcalEvent := range managed {
+		fmt.Printf("%s  %s  %s\n", gcalEvent.Id, formatCalendarEventStart(gcalEvent), gcalEvent.Summary)
+	}
+
+	if !confirm {
+		fmt.Printf("\nWould delete %d events; run \"prune --confirm\" to delete them\n", len(managed))
+		return nil
+	}
+
+	var operations []calendarOperation
+	for _, gcalEvent := range managed {
+		uid, _ := managedEventUID(gcalEvent)
+		op := newDeleteOperation(calendarID, gcalEvent, "uid", uid, "title", gcalEvent.Summary)
+		op.success = "Deleted event (pruned)"
+		operations = append(operations, op)
+	}
+	var pruneErrors []error
+	for _, err := range executeCalendarOperations(ctx, srv, operations, nil) {
+		if err != nil {
+			pruneErrors = append(pruneErrors, err)
+		}
+	}
+
+	// The next sync starts afresh rather than resuming an unfinished one
+	if err := saveCheckpoint(calendarID, nil); err != nil {
+		slog.Warn("Failed to clear sync checkpoint", "calendar_id", calendarID, "error", err)
+	}
+
+	fmt.Printf("\nDeleted %d of %d events\n", len(managed)-len(pruneErrors), len(managed))
+	if len(pruneErrors) > 0 {
+		return fmt.Errorf("%d deletions failed: %w", len(pruneErrors), errors.Join(pruneErrors...))
+	}
+	return nil
+}
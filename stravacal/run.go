@@ -0,0 +1,1141 @@
+package stravacal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Embed the timezone database so any event zone resolves in minimal containers
+)
+
+// Output files, relative to OUTPUT_DIR
+const (
+	eventsFile     = "events/events.json"
+	calendarFile   = "calendar.ics"
+	previewFile    = "calendar-preview.ics"
+	scheduleFile   = "schedules/index.html"
+	validationFile = "validation/events_raw.json"
+	syncReportFile = "sync-report.json"
+
+	// publicSyncReportFile is the sync report for GOOGLE_PUBLIC_CALENDAR_ID
+	publicSyncReportFile = "sync-report-public.json"
+
+	// calDAVSyncReportFile is the sync report for CALDAV_URL
+	calDAVSyncReportFile = "sync-report-caldav.json"
+
+	// splitCalendarDir holds the ICS files written with ICS_SPLIT_BY
+	splitCalendarDir = "calendars"
+
+	// defaultOutputDir is where output is written when OUTPUT_DIR is unset
+	defaultOutputDir = "output"
+
+	// defaultSyncWindowDays is how far ahead events are synced when SYNC_WINDOW_DAYS is unset
+	defaultSyncWindowDays = 60
+
+	// defaultFilterSinceDays is how far back events are kept when FILTER_SINCE_DAYS is unset
+	defaultFilterSinceDays = 7
+
+	// defaultDeleteGraceRuns is how many consecutive runs an event must be missing
+	// from Strava before it is cancelled when DELETE_GRACE_RUNS is unset
+	defaultDeleteGraceRuns = 1
+
+	// defaultMaxEvents caps the events fetched in one run when MAX_EVENTS is unset
+	defaultMaxEvents = 1000
+
+	// defaultRunTimeout is the deadline for a whole run when RUN_TIMEOUT is unset,
+	// so a stalled network can't hold a cron slot forever
+	defaultRunTimeout = 15 * time.Minute
+
+	// cancelledEventRetention is how long cancelled events stay in the ICS file
+	// so subscribers see them as cancelled rather than silently vanishing
+	cancelledEventRetention = 7 * 24 * time.Hour
+)
+
+// errTooManyEvents aborts a sync when Strava returns more events than MAX_EVENTS,
+// e.g. after a bad recurring rule, rather than flooding Google Calendar
+var errTooManyEvents = errors.New("too many events")
+
+// TemporaryError marks a failure that is likely to succeed if the run is retried
+// later, such as the Strava API being unavailable or rate limited
+type TemporaryError struct {
+	Err error
+}
+
+func (e *TemporaryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TemporaryError) Unwrap() error {
+	return e.Err
+}
+
+// syncCommands are the commands other than the full sync that work with events
+var syncCommands = []string{"test", "ics", "gcal", "dry-run", "html", "ics-validate", "serve", "backfill", "explain", "past", "digest", "list-synced", "prune", "doctor"}
+
+// unmonitoredCommands don't ping HEARTBEAT_URL: local test and dry runs and
+// one-off commands aren't scheduled runs, and the server pings for each sync itself
+var unmonitoredCommands = []string{"test", "dry-run", "ics-validate", "serve", "backfill", "explain", "past", "digest", "list-synced", "prune", "doctor"}
+
+// Run executes the command given by args with cfg, the full sync if args is
+// empty, as the strava-events command does. Flags that set configuration,
+// like --config and --club-id, must already be applied to cfg
+// Calls with a Config run one at a time, so other calls wait until the command
+// returns. The serve command is the exception: it only holds cfg while a sync
+// is running, letting other calls run while it waits for requests
+func Run(ctx context.Context, cfg Config, args []string) error {
+	defer use(cfg)()
+	return run(ctx, args)
+}
+
+// run executes the command given by args with the Config in use
+func run(ctx context.Context, args []string) error {
+	if err := setupLogging(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	args, limit, err := parseLimitFlag(args)
+	if err != nil {
+		return err
+	}
+
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	// These commands don't need the sync configuration, so they run before validation
+	switch command {
+	case "authorize":
+		return authorizeStrava()
+	case "config":
+		if len(args) < 2 || args[1] != "check" {
+			return fmt.Errorf("unknown config command, expected \"config check\"")
+		}
+		return checkConfig()
+	}
+
+	// Anything unrecognised runs the full sync, so validate it as one
+	if !slices.Contains(syncCommands, command) {
+		command = ""
+	}
+
+	// Syncing part of the events would delete the rest from the calendar
+	if limit > 0 && command != "dry-run" && command != "test" {
+		return fmt.Errorf("--limit is only supported by the dry-run and test commands")
+	}
+
+	var commandArgs []string
+	if len(args) > 1 {
+		commandArgs = args[1:]
+	}
+	err = runSync(ctx, command, commandArgs, limit)
+
+	// Report scheduled runs to the monitoring service
+	if !slices.Contains(unmonitoredCommands, command) {
+		if err != nil {
+			pingHeartbeat("fail", err)
+		} else {
+			pingHeartbeat("success", nil)
+		}
+	}
+
+	return err
+}
+
+// parseLimitFlag removes "--limit N" (or "--limit=N") from args, returning the
+// remaining args and N, or 0 if the flag isn't given
+func parseLimitFlag(args []string) ([]string, int, error) {
+	var rest []string
+	limit := 0
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value, found := strings.CutPrefix(arg, "--limit=")
+		if arg == "--limit" {
+			if i+1 >= len(args) {
+				return nil, 0, fmt.Errorf("--limit requires a number of events")
+			}
+			i++
+			value, found = args[i], true
+		}
+		if !found {
+			rest = append(rest, arg)
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil, 0, fmt.Errorf("--limit must be a positive integer, got %q", value)
+		}
+		limit = n
+	}
+	return rest, limit, nil
+}
+
+// runSync validates the configuration and runs a sync command ("" is the full sync)
+// commandArgs are the arguments after the command, and limit, if positive,
+// processes only the first limit events fetched from Strava
+// The command is cancelled by an interrupt or SIGTERM, and stopped after
+// RUN_TIMEOUT (each sync is limited instead in server mode)
+func runSync(ctx context.Context, command string, commandArgs []string, limit int) error {
+	if err := validateConfig(command); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if command != "serve" {
+		var cancel context.CancelFunc
+		ctx, cancel = withRunTimeout(ctx)
+		defer cancel()
+	}
+
+	err := runCommand(ctx, command, commandArgs, limit)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TemporaryError{Err: fmt.Errorf("run stopped after RUN_TIMEOUT (%s): %w", validated().runTimeout, err)}
+	}
+	return err
+}
+
+// runCommand runs a validated sync command with ctx
+func runCommand(ctx context.Context, command string, commandArgs []string, limit int) error {
+	// Every command except html and prune requires the club ID
+	windowDays := validated().windowDays
+	clubID := validated().clubID
+
+	switch command {
+	case "test":
+		return testWithSampleData(clubID, limit)
+	case "ics":
+		return generateICSOnly(windowDays, clubID)
+	case "gcal":
+		return syncGoogleCalendarOnly(ctx, windowDays, clubID)
+	case "dry-run":
+		return dryRunSync(ctx, windowDays, clubID, limit)
+	case "html":
+		return generateHTMLScheduleFile(windowDays)
+	case "ics-validate":
+		return validateICSFile(windowDays, clubID)
+	case "serve":
+		return serve(ctx, windowDays, clubID)
+	case "backfill":
+		from, to, err := parseDateRange("backfill", commandArgs)
+		if err != nil {
+			return err
+		}
+		return backfillArchive(ctx, clubID, from, to)
+	case "explain":
+		eventID, err := parseExplainArgs(commandArgs)
+		if err != nil {
+			return err
+		}
+		return explainEvent(ctx, eventID, windowDays, clubID)
+	case "past":
+		from, to, err := parseDateRange("past", commandArgs)
+		if err != nil {
+			return err
+		}
+		return fetchPastEvents(ctx, from, to)
+	case "digest":
+		return sendDigest()
+	case "list-synced":
+		return listSyncedEvents(ctx)
+	case "prune":
+		confirm, err := parsePruneArgs(commandArgs)
+		if err != nil {
+			return err
+		}
+		return pruneCalendar(ctx, confirm)
+	case "doctor":
+		return runDoctor(ctx)
+	}
+
+	_, err := fullSync(ctx, windowDays, clubID)
+	return err
+}
+
+// getRunTimeout returns the deadline for a whole run from RUN_TIMEOUT, a
+// duration such as "10m"; 0 means no deadline
+func getRunTimeout() (time.Duration, error) {
+	value := getenv("RUN_TIMEOUT")
+	if value == "" {
+		return defaultRunTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("RUN_TIMEOUT must be a duration like 10m or 1h (0 for none), got %q", value)
+	}
+	return timeout, nil
+}
+
+// withRunTimeout returns ctx with the RUN_TIMEOUT deadline, if any
+func withRunTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := validated().runTimeout
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// fullSync fetches from Strava, syncs to Google Calendar and any CalDAV calendar, and
+// generates the ICS and HTML files
+// The report is nil when Google Calendar sync is skipped or the diff didn't complete
+func fullSync(ctx context.Context, windowDays int, clubID string) (*SyncReport, error) {
+	log.Println("Starting Strava to Google Calendar Sync...")
+
+	// Load Strava tokens
+	tokens, err := loadTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokens: %w", err)
+	}
+
+	// Fetch events from Strava
+	finalEvents, err := fetchStravaEvents(ctx, tokens, validated().clubIDs, 0)
+	var clubErr *ClubFetchError
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &clubErr) {
+		slog.Warn("Continuing with the clubs that were fetched", "failed_clubs", clubErr.Clubs())
+	} else if errors.As(err, &rateLimitErr) {
+		return nil, &TemporaryError{Err: err}
+	} else if errors.Is(err, errTooManyEvents) {
+		return nil, err
+	} else if err != nil {
+		return nil, &TemporaryError{Err: fmt.Errorf("failed to fetch events from API (might be temporarily unavailable): %w", err)}
+	}
+	fetchedCount := len(finalEvents)
+
+	// Keep events that disappeared from Strava as cancelled for a grace period
+	existingEvents, err := loadExistingEvents()
+	if err != nil {
+		if clubErr != nil {
+			// Without the cache, the failed clubs' events would be deleted from the calendars
+			return nil, &TemporaryError{Err: clubErr}
+		}
+		slog.Warn("Could not load cached events to detect cancellations", "error", err)
+	} else {
+		// Keep the failed clubs' cached events as they were until they can be fetched again
+		if clubErr != nil {
+			finalEvents = append(finalEvents, eventsFromClubs(existingEvents, clubErr.Clubs())...)
+		}
+
+		finalEvents = mergeCachedEvents(finalEvents, existingEvents, time.Now())
+	}
+
+	// Save events to JSON for backup
+	log.Printf("Saving %d events to %s...", len(finalEvents), eventStorePath())
+	if err := saveEvents(finalEvents); err != nil {
+		return nil, fmt.Errorf("failed to save events: %w", err)
+	}
+
+	// Get Google Calendar ID from environment
+	var report *SyncReport
+	calendarID := getenv("GOOGLE_CALENDAR_ID")
+	if calendarID == "" {
+		slog.Warn("GOOGLE_CALENDAR_ID not set, skipping Google Calendar sync")
+	} else {
+		// Authenticate with Google Calendar
+		log.Println("Authenticating with Google Calendar...")
+		calendarService, err := getCalendarService()
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate with Google Calendar: %w", err)
+		}
+		if err := checkCalendarAccess(ctx, calendarService, calendarID); err != nil {
+			return nil, err
+		}
+
+		// Sync all events with Google Calendar (no date filtering)
+		log.Printf("Syncing %d events with Google Calendar...", len(finalEvents))
+		report, err = syncStravaEvents(ctx, finalEvents, calendarService, calendarID, clubID, windowDays, false)
+		if report != nil {
+			report.Fetched = fetchedCount
+			if err := saveSyncReport(syncReportFile, report); err != nil {
+				slog.Warn("Failed to save sync report", "error", err)
+			}
+			notifySyncChanges(report)
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to sync events with Google Calendar: %w", err)
+		}
+
+		publicReport, err := syncPublicCalendar(ctx, finalEvents, calendarService, clubID, windowDays, false)
+		if publicReport != nil {
+			publicReport.Fetched = fetchedCount
+			if err := saveSyncReport(publicSyncReportFile, publicReport); err != nil {
+				slog.Warn("Failed to save public sync report", "error", err)
+			}
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to sync events with public Google Calendar: %w", err)
+		}
+
+		log.Println("✓ Google Calendar sync completed successfully!")
+	}
+
+	if sink := calDAVSinkFor(clubID); sink != nil {
+		log.Printf("Syncing %d events with %s...", len(finalEvents), sink.Name())
+		calDAVReport, err := syncSink(ctx, sink, finalEvents, false, nil)
+		if calDAVReport != nil {
+			calDAVReport.Fetched = fetchedCount
+			if err := saveSyncReport(calDAVSyncReportFile, calDAVReport); err != nil {
+				slog.Warn("Failed to save CalDAV sync report", "error", err)
+			}
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to sync events with CalDAV: %w", err)
+		}
+		log.Println("✓ CalDAV sync completed successfully!")
+	}
+
+	// Generate ICS file
+	log.Println("Generating ICS file...")
+	if err := generateICSFromCache(windowDays, clubID); err != nil {
+		return report, err
+	}
+
+	// Generate HTML schedule
+	log.Println("Generating HTML schedule...")
+	if err := generateHTMLScheduleFile(windowDays); err != nil {
+		return report, err
+	}
+
+	log.Println("✓ All tasks completed successfully!")
+	return report, nil
+}
+
+// getSyncWindowDays returns the number of days ahead to sync from SYNC_WINDOW_DAYS
+// Defaults to 60 days when unset; must be a positive integer
+func getSyncWindowDays() (int, error) {
+	value := getenv("SYNC_WINDOW_DAYS")
+	if value == "" {
+		return defaultSyncWindowDays, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("SYNC_WINDOW_DAYS must be a positive integer, got %q", value)
+	}
+	return days, nil
+}
+
+// getFilterSinceDays returns how many days of past events are kept, from FILTER_SINCE_DAYS
+// 0 keeps only events that haven't started yet
+func getFilterSinceDays() (int, error) {
+	value := getenv("FILTER_SINCE_DAYS")
+	if value == "" {
+		return defaultFilterSinceDays, nil
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("FILTER_SINCE_DAYS must be a non-negative integer, got %q", value)
+	}
+	return days, nil
+}
+
+// getDeleteGraceRuns returns how many consecutive runs an event must be missing
+// from the Strava fetch before it is cancelled, from DELETE_GRACE_RUNS
+// Guards against the API briefly returning a truncated list
+func getDeleteGraceRuns() (int, error) {
+	value := getenv("DELETE_GRACE_RUNS")
+	if value == "" {
+		return defaultDeleteGraceRuns, nil
+	}
+
+	runs, err := strconv.Atoi(value)
+	if err != nil || runs <= 0 {
+		return 0, fmt.Errorf("DELETE_GRACE_RUNS must be a positive integer, got %q", value)
+	}
+	return runs, nil
+}
+
+// filterSince returns the earliest start time of events that are kept
+func filterSince(now time.Time) time.Time {
+	return now.AddDate(0, 0, -validated().filterSinceDays)
+}
+
+// fetchStravaEvents fetches the events of every club from Strava and converts
+// them to our format, filtered and sorted the same way they are cached
+// If only some clubs fail, the other clubs' events are returned with a *ClubFetchError
+func fetchStravaEvents(ctx context.Context, tokens *TokenStore, clubIDs []string, limit int) ([]Event, error) {
+	log.Println("Fetching club events from Strava API...")
+	clubEvents, err := fetchClubsEvents(ctx, tokens, clubIDs, true)
+	var clubErr *ClubFetchError
+	if err != nil && !errors.As(err, &clubErr) {
+		return nil, err
+	}
+
+	// Convert Strava events to our format, club by club
+	var convertedEvents []Event
+	processed := 0
+clubs:
+	for _, clubID := range clubIDs {
+		stravaEvents, ok := clubEvents[clubID]
+		if !ok {
+			continue
+		}
+		log.Printf("Fetched %d events from Strava club %s", len(stravaEvents), clubID)
+		for _, se := range stravaEvents {
+			if limit > 0 && processed == limit {
+				log.Printf("Processing only the first %d events (--limit)", limit)
+				break clubs
+			}
+			processed++
+
+			events, err := convertStravaEvent(se, clubID)
+			if err != nil {
+				log.Printf("Failed to convert event %d: %v", se.ID, err)
+				continue
+			}
+			convertedEvents = append(convertedEvents, events...)
+		}
+	}
+
+	// Replace coordinate-only addresses with place names, if enabled
+	resolveLocations(ctx, convertedEvents)
+
+	// Merge runs posted to several clubs, if enabled. After geocoding, so
+	// copies with the same coordinates match by place name
+	if validated().mergeClubDuplicates {
+		convertedEvents = mergeClubDuplicates(convertedEvents)
+	}
+
+	// Filter and sort events
+	log.Println("Filtering and sorting events...")
+	finalEvents := filterAndSortEvents(convertedEvents)
+
+	if err := checkMaxEvents(finalEvents); err != nil {
+		return nil, err
+	}
+	if clubErr != nil {
+		return finalEvents, clubErr
+	}
+	return finalEvents, nil
+}
+
+// getMaxEvents returns the most events a run may sync, from MAX_EVENTS
+// 0 removes the cap
+func getMaxEvents() (int, error) {
+	value := getenv("MAX_EVENTS")
+	if value == "" {
+		return defaultMaxEvents, nil
+	}
+
+	maxEvents, err := strconv.Atoi(value)
+	if err != nil || maxEvents < 0 {
+		return 0, fmt.Errorf("MAX_EVENTS must be a non-negative integer, got %q", value)
+	}
+	return maxEvents, nil
+}
+
+// checkMaxEvents returns errTooManyEvents if there are more events than MAX_EVENTS
+func checkMaxEvents(events []Event) error {
+	maxEvents := validated().maxEvents
+	if maxEvents > 0 && len(events) > maxEvents {
+		return fmt.Errorf("%w: Strava returned %d events, more than MAX_EVENTS (%d); check the club for runaway recurring events or raise MAX_EVENTS", errTooManyEvents, len(events), maxEvents)
+	}
+	return nil
+}
+
+// dryRunSync runs the full fetch and diff pipeline but only logs the calendar
+// changes it would make; neither Google Calendar nor the JSON cache is modified
+func dryRunSync(ctx context.Context, windowDays int, clubID string, limit int) error {
+	log.Println("Starting dry run (no changes will be made)...")
+
+	tokens, err := loadTokens()
+	if err != nil {
+		return fmt.Errorf("failed to load tokens: %w", err)
+	}
+
+	finalEvents, err := fetchStravaEvents(ctx, tokens, validated().clubIDs, limit)
+	var clubErr *ClubFetchError
+	if errors.As(err, &clubErr) {
+		slog.Warn("Continuing with the clubs that were fetched", "failed_clubs", clubErr.Clubs())
+	} else if errors.Is(err, errTooManyEvents) {
+		return err
+	} else if err != nil {
+		return &TemporaryError{Err: fmt.Errorf("failed to fetch events from API: %w", err)}
+	}
+
+	// Merge the cache as fullSync does, so events in their grace period or
+	// recently cancelled don't show up as deletions
+	if existingEvents, err := loadExistingEvents(); err != nil {
+		slog.Warn("Could not load cached events to detect cancellations", "error", err)
+	} else {
+		// Diff the failed clubs' cached events so they don't show up as deletions
+		if clubErr != nil {
+			finalEvents = append(finalEvents, eventsFromClubs(existingEvents, clubErr.Clubs())...)
+		}
+		finalEvents = mergeCachedEvents(finalEvents, existingEvents, time.Now())
+	}
+
+	calendarID := getenv("GOOGLE_CALENDAR_ID")
+	if calendarID == "" {
+		return fmt.Errorf("GOOGLE_CALENDAR_ID environment variable is not set")
+	}
+
+	log.Println("Authenticating with Google Calendar...")
+	calendarService, err := getCalendarService()
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with Google Calendar: %w", err)
+	}
+	if err := checkCalendarAccess(ctx, calendarService, calendarID); err != nil {
+		return err
+	}
+
+	log.Printf("Diffing %d events against Google Calendar...", len(finalEvents))
+	if _, err := syncStravaEvents(ctx, finalEvents, calendarService, calendarID, clubID, windowDays, true); err != nil {
+		return fmt.Errorf("failed to diff events with Google Calendar: %w", err)
+	}
+	if _, err := syncPublicCalendar(ctx, finalEvents, calendarService, clubID, windowDays, true); err != nil {
+		return fmt.Errorf("failed to diff events with public Google Calendar: %w", err)
+	}
+
+	if sink := calDAVSinkFor(clubID); sink != nil {
+		log.Printf("Diffing %d events against %s...", len(finalEvents), sink.Name())
+		if _, err := syncSink(ctx, sink, finalEvents, true, nil); err != nil {
+			return fmt.Errorf("failed to diff events with CalDAV: %w", err)
+		}
+	}
+
+	log.Println("✓ Dry run completed, no changes were made")
+	return nil
+}
+
+// generateICSFromCache generates ICS file from cached events
+func generateICSFromCache(windowDays int, clubID string) error {
+	// Load events from JSON
+	events, err := loadExistingEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load existing events: %w", err)
+	}
+
+	// Filter for events within the sync window
+	filteredEvents := filterEventsInWindow(events, windowDays)
+
+	// Sort chronologically
+	sort.Slice(filteredEvents, func(i, j int) bool {
+		return filteredEvents[i].Start.Before(filteredEvents[j].Start)
+	})
+
+	// Generate and save ICS file
+	published, err := writeICSFiles(filteredEvents, clubID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Generated %s with %d events from next %d days", outputPath(calendarFile), published, windowDays)
+	return nil
+}
+
+// generateICSOnly generates only the ICS file from cached events
+func generateICSOnly(windowDays int, clubID string) error {
+	log.Println("Generating ICS file from cached events...")
+
+	// Load events from JSON
+	events, err := loadExistingEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load existing events: %w", err)
+	}
+
+	// Filter for events within the sync window
+	filteredEvents := filterEventsInWindow(events, windowDays)
+
+	// Sort chronologically
+	sort.Slice(filteredEvents, func(i, j int) bool {
+		return filteredEvents[i].Start.Before(filteredEvents[j].Start)
+	})
+
+	// Generate and save ICS file
+	published, err := writeICSFiles(filteredEvents, clubID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Generated %s with %d events", outputPath(calendarFile), published)
+	return nil
+}
+
+// generateHTMLScheduleFile generates the HTML schedule from cached events
+func generateHTMLScheduleFile(windowDays int) error {
+	// Load events from JSON
+	events, err := loadExistingEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load existing events: %w", err)
+	}
+
+	// Filter for events within the sync window
+	filteredEvents := filterEventsInWindow(events, windowDays)
+
+	// Sort chronologically
+	sort.Slice(filteredEvents, func(i, j int) bool {
+		return filteredEvents[i].Start.Before(filteredEvents[j].Start)
+	})
+
+	// Generate and save HTML schedule
+	htmlContent := generateHTMLSchedule(filteredEvents)
+	if err := writeOutputFile(scheduleFile, []byte(htmlContent)); err != nil {
+		return fmt.Errorf("error saving HTML schedule: %w", err)
+	}
+
+	log.Printf("Generated %s with %d events", outputPath(scheduleFile), len(filteredEvents))
+	return nil
+}
+
+// syncGoogleCalendarOnly syncs cached events to Google Calendar only
+func syncGoogleCalendarOnly(ctx context.Context, windowDays int, clubID string) error {
+	log.Println("Syncing cached events to Google Calendar...")
+
+	// Load events from JSON
+	events, err := loadExistingEvents()
+	if err != nil {
+		return fmt.Errorf("failed to load existing events: %w", err)
+	}
+
+	// Get Google Calendar ID from environment
+	calendarID := getenv("GOOGLE_CALENDAR_ID")
+	if calendarID == "" {
+		return fmt.Errorf("GOOGLE_CALENDAR_ID environment variable is not set")
+	}
+
+	// Authenticate with Google Calendar
+	log.Println("Authenticating with Google Calendar...")
+	calendarService, err := getCalendarService()
+	if err != nil {
+		return fmt.Errorf("failed to authenticate with Google Calendar: %w", err)
+	}
+	if err := checkCalendarAccess(ctx, calendarService, calendarID); err != nil {
+		return err
+	}
+
+	// Filter events within the sync window
+	eventsToSync := filterEventsInWindow(events, windowDays)
+
+	// Sync events with Google Calendar
+	log.Printf("Syncing %d events with Google Calendar...", len(eventsToSync))
+	report, err := syncStravaEvents(ctx, eventsToSync, calendarService, calendarID, clubID, windowDays, false)
+	if report != nil {
+		if err := saveSyncReport(syncReportFile, report); err != nil {
+			slog.Warn("Failed to save sync report", "error", err)
+		}
+		notifySyncChanges(report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sync events with Google Calendar: %w", err)
+	}
+
+	publicReport, err := syncPublicCalendar(ctx, eventsToSync, calendarService, clubID, windowDays, false)
+	if publicReport != nil {
+		if err := saveSyncReport(publicSyncReportFile, publicReport); err != nil {
+			slog.Warn("Failed to save public sync report", "error", err)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sync events with public Google Calendar: %w", err)
+	}
+
+	log.Println("✓ Google Calendar sync completed successfully!")
+	return nil
+}
+
+// testWithSampleData tests the application with sample data from events_raw.json
+func testWithSampleData(clubID string, limit int) error {
+	log.Println("Testing with sample data from events_raw.json...")
+
+	data, err := os.ReadFile(outputPath(validationFile))
+	if err != nil {
+		return fmt.Errorf("failed to read sample events file: %w", err)
+	}
+
+	var stravaEvents []StravaEvent
+	if err := json.Unmarshal(data, &stravaEvents); err != nil {
+		return fmt.Errorf("failed to parse sample events: %w", err)
+	}
+
+	log.Printf("Loaded %d sample events", len(stravaEvents))
+	if limit > 0 && len(stravaEvents) > limit {
+		log.Printf("Processing only the first %d events (--limit)", limit)
+		stravaEvents = stravaEvents[:limit]
+	}
+
+	var convertedEvents []Event
+	for _, se := range stravaEvents {
+		events, err := convertStravaEvent(se, clubID)
+		if err != nil {
+			log.Printf("Failed to convert event %d: %v", se.ID, err)
+			continue
+		}
+		convertedEvents = append(convertedEvents, events...)
+	}
+
+	log.Printf("Converted %d events", len(convertedEvents))
+
+	log.Println("Filtering and sorting events...")
+	finalEvents := filterAndSortEvents(convertedEvents)
+
+	log.Printf("Saving %d events to %s...", len(finalEvents), eventStorePath())
+	if err := saveEvents(finalEvents); err != nil {
+		return fmt.Errorf("failed to save events: %w", err)
+	}
+
+	log.Printf("Successfully saved %d events to %s", len(finalEvents), eventStorePath())
+
+	for i, event := range finalEvents {
+		if i < 5 {
+			fmt.Printf("Event %d: %s - %s (%s)\n", event.ID, event.Title,
+				event.Start.Format("2006-01-02 15:04"), event.Location)
+		}
+	}
+	if len(finalEvents) > 5 {
+		fmt.Printf("... and %d more events\n", len(finalEvents)-5)
+	}
+
+	return nil
+}
+
+// getIncludeWomenOnly reports whether women-only events are published, from INCLUDE_WOMEN_ONLY (default true)
+func getIncludeWomenOnly() (bool, error) {
+	value := getenv("INCLUDE_WOMEN_ONLY")
+	if value == "" {
+		return true, nil
+	}
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("INCLUDE_WOMEN_ONLY must be true or false, got %q", value)
+	}
+	return include, nil
+}
+
+// getPrivateEventsFilter returns how private events are handled, from PRIVATE_EVENTS:
+// - "include" (default): publish private and public events
+// - "exclude": publish only public events
+// - "only": publish only private events
+func getPrivateEventsFilter() (string, error) {
+	value := strings.ToLower(getenv("PRIVATE_EVENTS"))
+	switch value {
+	case "":
+		return "include", nil
+	case "include", "exclude", "only":
+		return value, nil
+	default:
+		return "", fmt.Errorf("PRIVATE_EVENTS must be include, exclude or only, got %q", value)
+	}
+}
+
+// getExcludedEventIDs parses EXCLUDE_EVENT_IDS, a comma-separated list of
+// Strava event IDs that are never published
+func getExcludedEventIDs() (map[int64]bool, error) {
+	ids := make(map[int64]bool)
+	value := getenv("EXCLUDE_EVENT_IDS")
+	if value == "" {
+		return ids, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(item), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("EXCLUDE_EVENT_IDS must be a comma-separated list of event IDs, got %q", item)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// getExcludeTitlePattern returns the EXCLUDE_TITLE_REGEX pattern for titles of
+// events that are never published, or nil when unset
+func getExcludeTitlePattern() (*regexp.Regexp, error) {
+	value := getenv("EXCLUDE_TITLE_REGEX")
+	if value == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("EXCLUDE_TITLE_REGEX is not a valid regular expression: %w", err)
+	}
+	return pattern, nil
+}
+
+// defaultTentativeTitlePattern marks events titled e.g. "[TBC] Long Run" as
+// provisional when TENTATIVE_TITLE_REGEX is unset
+const defaultTentativeTitlePattern = `(?i)^\s*\[TBC\]`
+
+// getTentativeTitlePattern returns the pattern for titles of provisional events,
+// from TENTATIVE_TITLE_REGEX
+func getTentativeTitlePattern() (*regexp.Regexp, error) {
+	value := getenv("TENTATIVE_TITLE_REGEX")
+	if value == "" {
+		value = defaultTentativeTitlePattern
+	}
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("TENTATIVE_TITLE_REGEX is not a valid regular expression: %w", err)
+	}
+	return pattern, nil
+}
+
+// isTentativeEvent reports whether an event is provisional, which Strava has no
+// field for, so it is marked by its title (see getTentativeTitlePattern)
+func isTentativeEvent(event Event) bool {
+	return validated().tentativeTitle.MatchString(event.Title)
+}
+
+// getTitleTagPattern returns the pattern for tags written in event titles, e.g.
+// "[Social]", from TITLE_TAG_REGEX, or nil when unset. Strava events have no
+// tags of their own
+func getTitleTagPattern() (*regexp.Regexp, error) {
+	value := getenv("TITLE_TAG_REGEX")
+	if value == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("TITLE_TAG_REGEX is not a valid regular expression: %w", err)
+	}
+	return pattern, nil
+}
+
+// eventTags returns the tags in an event's title matched by TITLE_TAG_REGEX,
+// using each match's first group when the pattern has one, e.g. "Social" from
+// "[Social] Pub Run" with \[([^\]]+)\]
+func eventTags(event Event) []string {
+	pattern := validated().titleTag
+	if pattern == nil {
+		return nil
+	}
+	var tags []string
+	for _, match := range pattern.FindAllStringSubmatch(event.Title, -1) {
+		tag := match[0]
+		if len(match) > 1 && match[1] != "" {
+			tag = match[1]
+		}
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// includeEvent reports whether an event passes the women-only, private, event ID
+// and title filters, logging the reason for any exclusion at DEBUG level
+func includeEvent(event Event) bool {
+	if reason := exclusionReason(event); reason != "" {
+		slog.Debug("Excluding event", "event_id", event.ID, "title", event.Title, "reason", reason)
+		return false
+	}
+	return true
+}
+
+// exclusionReason returns why an event is filtered out, or "" if it is published
+func exclusionReason(event Event) string {
+	if event.WomenOnly && !validated().includeWomenOnly {
+		return "women-only (INCLUDE_WOMEN_ONLY)"
+	}
+
+	switch privateFilter := validated().privateEvents; {
+	case privateFilter == "exclude" && event.Private:
+		return "private (PRIVATE_EVENTS)"
+	case privateFilter == "only" && !event.Private:
+		return "public (PRIVATE_EVENTS)"
+	}
+
+	if validated().excludedEventIDs[event.ID] {
+		return "event ID excluded (EXCLUDE_EVENT_IDS)"
+	}
+	if pattern := validated().excludeTitle; pattern != nil && pattern.MatchString(event.Title) {
+		return "title matches EXCLUDE_TITLE_REGEX"
+	}
+	return ""
+}
+
+// filterEvents filters events to only include those from FILTER_SINCE_DAYS ago onwards,
+// dropping any excluded by the women-only and private filters
+func filterEvents(events []Event) []Event {
+	since := filterSince(time.Now())
+
+	var filtered []Event
+	for _, event := range events {
+		if event.Start.After(since) && includeEvent(event) {
+			filtered = append(filtered, event)
+		}
+	}
+
+	return filtered
+}
+
+// filterEventsInWindow returns events starting between FILTER_SINCE_DAYS ago and windowDays from now
+func filterEventsInWindow(events []Event, windowDays int) []Event {
+	now := time.Now()
+	since := filterSince(now)
+	windowEnd := now.AddDate(0, 0, windowDays)
+
+	var filtered []Event
+	for _, event := range events {
+		if event.Start.After(since) && event.Start.Before(windowEnd) {
+			filtered = append(filtered, event)
+		}
+	}
+
+	return filtered
+}
+
+// eventsFromClubs returns the events that were fetched from any of clubIDs
+func eventsFromClubs(events []Event, clubIDs []string) []Event {
+	var fromClubs []Event
+	for _, event := range events {
+		if slices.Contains(clubIDs, event.ClubID) {
+			fromClubs = append(fromClubs, event)
+		}
+	}
+	return fromClubs
+}
+
+// mergeCachedEvents merges the cached events that pass the current filters into
+// the fresh fetch with mergeCancelledEvents, so an event excluded since it was
+// cached is deleted rather than kept as cancelled
+func mergeCachedEvents(fresh, cached []Event, now time.Time) []Event {
+	var included []Event
+	for _, event := range cached {
+		if includeEvent(event) {
+			included = append(included, event)
+		}
+	}
+	return mergeCancelledEvents(fresh, included, validated().deleteGraceRuns, now)
+}
+
+// mergeCancelledEvents adds cancellation tombstones for cached events that are
+// missing from the fresh Strava fetch
+// - Upcoming events that vanished are kept until missing for graceRuns consecutive runs
+// - They are then marked cancelled as of now
+// - Existing tombstones are kept until cancelledEventRetention has passed
+// - Events that reappear on Strava are no longer treated as missing or cancelled
+func mergeCancelledEvents(fresh, existing []Event, graceRuns int, now time.Time) []Event {
+	freshUIDs := make(map[string]bool)
+	for _, event := range fresh {
+		freshUIDs[eventUID(event)] = true
+		// Copies merged into another club's event are still on Strava
+		for _, uid := range duplicateUIDs(event) {
+			freshUIDs[uid] = true
+		}
+	}
+
+	merged := fresh
+	for _, event := range existing {
+		if freshUIDs[eventUID(event)] {
+			continue
+		}
+
+		if event.CancelledAt == nil {
+			// Past events drop out of the upcoming feed naturally, they weren't cancelled
+			if !event.Start.After(now) {
+				continue
+			}
+			if event.MissingSince == nil {
+				missingSince := now
+				event.MissingSince = &missingSince
+			}
+			event.MissingRuns++
+			if event.MissingRuns < graceRuns {
+				slog.Warn("Event missing from Strava, keeping it for now", "event_id", event.ID, "uid", eventUID(event), "title", event.Title, "missing_runs", event.MissingRuns, "grace_runs", graceRuns)
+			} else {
+				cancelledAt := now
+				event.CancelledAt = &cancelledAt
+				slog.Info("Event cancelled on Strava", "event_id", event.ID, "uid", eventUID(event), "title", event.Title, "missing_since", event.MissingSince)
+			}
+		} else if now.Sub(*event.CancelledAt) > cancelledEventRetention {
+			continue
+		}
+
+		merged = append(merged, event)
+	}
+
+	// Keep the cache in the same newest-first order as filterAndSortEvents
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Start.After(merged[j].Start)
+	})
+
+	return merged
+}
+
+// filterAndSortEvents filters and sorts events by start time (newest first)
+func filterAndSortEvents(events []Event) []Event {
+	filtered := filterEvents(events)
+
+	// Sort events by start time in reverse chronological order (newest first)
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Start.After(filtered[j].Start)
+	})
+
+	return filtered
+}
+
+// syncPublicCalendar syncs sanitized copies of events to GOOGLE_PUBLIC_CALENDAR_ID,
+// returning a nil report when it isn't set. The public calendar is diffed against
+// its own contents, so updates and deletions are tracked separately from the main one
+func syncPublicCalendar(ctx context.Context, events []Event, srv *CalendarService, clubID string, windowDays int, dryRun bool) (*SyncReport, error) {
+	calendarID := getenv("GOOGLE_PUBLIC_CALENDAR_ID")
+	if calendarID == "" {
+		return nil, nil
+	}
+
+	if err := checkCalendarAccess(ctx, srv, calendarID); err != nil {
+		return nil, err
+	}
+
+	publicEvents := make([]Event, len(events))
+	for i, event := range events {
+		publicEvents[i] = sanitizeForPublic(event)
+	}
+
+	log.Printf("Syncing %d events with public Google Calendar...", len(publicEvents))
+	return syncStravaEvents(ctx, publicEvents, srv, calendarID, clubID, windowDays, dryRun)
+}
+
+// saveSyncReport writes the summary of a Google Calendar sync for monitoring
+func saveSyncReport(name string, report *SyncReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync report: %w", err)
+	}
+
+	if err := writeOutputFile(name, data); err != nil {
+		return fmt.Errorf("failed to write sync report: %w", err)
+	}
+
+	log.Printf("Sync report: %d created, %d updated, %d deleted, %d unchanged, %d failed",
+		report.Created, report.Updated, report.Deleted, report.Skipped, report.Failed)
+	return nil
+}
+
+// getOutputDir returns the directory output files are written to, from OUTPUT_DIR
+func getOutputDir() string {
+	if dir := getenv("OUTPUT_DIR"); dir != "" {
+		return dir
+	}
+	return defaultOutputDir
+}
+
+// outputPath returns the path of a file inside the output directory
+func outputPath(name string) string {
+	return filepath.Join(getOutputDir(), name)
+}
+
+// writeOutputFile writes a file inside the output directory, creating its
+// subdirectory first
+func writeOutputFile(name string, data []byte) error {
+	path := outputPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
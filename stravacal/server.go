@@ -0,0 +1,220 @@
+package stravacal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultServePort is the port the serve command listens on when SERVE_PORT is unset
+	defaultServePort = 8080
+
+	// syncSecretHeader carries SYNC_SECRET on requests to POST /sync
+	syncSecretHeader = "X-Sync-Secret"
+
+	// outputCacheControl lets clients reuse served files briefly, then revalidate
+	// with the ETag; scheduled syncs run every 15 minutes
+	outputCacheControl = "public, max-age=300"
+)
+
+// syncResponse is the JSON summary returned by POST /sync
+type syncResponse struct {
+	Status   string      `json:"status"` // "success" or "fail"
+	Error    string      `json:"error,omitempty"`
+	Duration string      `json:"duration"`
+	Report   *SyncReport `json:"report,omitempty"` // Missing when Google Calendar sync was skipped
+}
+
+// syncServer runs full syncs on request, one at a time
+type syncServer struct {
+	ctx        context.Context // Base of each sync's context, with RUN_TIMEOUT applied per sync
+	cfg        Config          // Used by each sync, since the server doesn't hold it in between
+	windowDays int
+	clubID     string
+	secret     string
+	mu         sync.Mutex // Held for the duration of a sync so requests don't overlap
+}
+
+// getServePort returns the port for the serve command from SERVE_PORT
+func getServePort() (int, error) {
+	value := getenv("SERVE_PORT")
+	if value == "" {
+		return defaultServePort, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("SERVE_PORT must be a port number, got %q", value)
+	}
+	return port, nil
+}
+
+// serve starts an HTTP server that runs the full sync on demand:
+// - POST /sync runs the sync and returns a JSON summary
+// - Sync requests must send SYNC_SECRET in the X-Sync-Secret header
+// - GET /calendar.ics and GET / serve the latest ICS file and HTML schedule
+// - GET /calendars/<name>.ics serves the split ICS files, with ICS_SPLIT_BY
+// - GET /healthz reports that the server is up
+// Runs until ctx is cancelled, e.g. by an interrupt, finishing any sync in
+// progress before exiting
+// The Config in use is only held during syncs, so other calls can run while
+// the server waits for requests
+func serve(ctx context.Context, windowDays int, clubID string) error {
+	port := validated().servePort
+
+	// Syncs run often, so keep the calendar's events between them and only
+	// fetch what changed
+	eventCache = newCalendarEventCache()
+	defer func() { eventCache = nil }()
+
+	s := &syncServer{
+		// Shutting down waits for a running sync rather than cancelling it
+		ctx:        context.WithoutCancel(ctx),
+		cfg:        *current(),
+		windowDays: windowDays,
+		clubID:     clubID,
+		secret:     getenv("SYNC_SECRET"),
+	}
+
+	// Output paths are resolved now, as the files are served without the Config
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sync", s.handleSync)
+	mux.HandleFunc("GET /calendar.ics", serveOutputFile(outputPath(calendarFile), "text/calendar; charset=utf-8"))
+	mux.HandleFunc("GET /calendar-preview.ics", serveOutputFile(outputPath(previewFile), "text/calendar; charset=utf-8"))
+	mux.HandleFunc("GET /calendars/{name}", serveSplitCalendar(outputPath(splitCalendarDir)))
+	mux.HandleFunc("GET /{$}", serveOutputFile(outputPath(scheduleFile), "text/html; charset=utf-8"))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	resume := suspend()
+	defer resume()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	log.Printf("Listening on %s", server.Addr)
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Shutdown waits for in-flight requests, so a running sync isn't left half done
+	log.Println("Shutting down...")
+	if err := server.Shutdown(context.Background()); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	return nil
+}
+
+// handleSync runs a full sync and responds with its outcome
+// Concurrent requests wait for the running sync to finish, then run their own
+func (s *syncServer) handleSync(w http.ResponseWriter, r *http.Request) {
+	secret := r.Header.Get(syncSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(s.secret)) != 1 {
+		http.Error(w, "invalid or missing "+syncSecretHeader+" header", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer use(s.cfg)()
+
+	slog.Info("Sync requested", "remote_addr", r.RemoteAddr)
+	start := time.Now()
+	ctx, cancel := withRunTimeout(s.ctx)
+	report, err := fullSync(ctx, s.windowDays, s.clubID)
+	cancel()
+
+	response := syncResponse{
+		Status:   "success",
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+		Report:   report,
+	}
+	status := http.StatusOK
+	if err != nil {
+		slog.Error("Sync failed", "error", err)
+		response.Status = "fail"
+		response.Error = err.Error()
+		status = http.StatusInternalServerError
+		var tempErr *TemporaryError
+		if errors.As(err, &tempErr) {
+			status = http.StatusServiceUnavailable
+		}
+		pingHeartbeat("fail", err)
+	} else {
+		pingHeartbeat("success", nil)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Warn("Failed to write sync response", "error", err)
+	}
+}
+
+// serveSplitCalendar returns a handler for the ICS files written to dir with
+// ICS_SPLIT_BY
+func serveSplitCalendar(dir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Only names writeSplitICSFiles could have written, so no path escapes the directory
+		name := r.PathValue("name")
+		if partitionFileName(strings.TrimSuffix(name, ".ics")) != name {
+			http.NotFound(w, r)
+			return
+		}
+		serveOutputFile(filepath.Join(dir, name), "text/calendar; charset=utf-8")(w, r)
+	}
+}
+
+// serveOutputFile returns a handler for the most recently generated copy of the
+// output file at path, with an ETag of its content hash so clients can make
+// conditional requests (If-None-Match is answered with 304 Not Modified)
+func serveOutputFile(path, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			http.Error(w, "not generated yet, run a sync first", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to read output file", "path", path, "error", err)
+			http.Error(w, "failed to read file", http.StatusInternalServerError)
+			return
+		}
+
+		var modTime time.Time
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+
+		hash := sha256.Sum256(data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", outputCacheControl)
+		http.ServeContent(w, r, filepath.Base(path), modTime, bytes.NewReader(data))
+	}
+}
@@ -0,0 +1,236 @@
+package stravacal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// CalendarSink is a calendar that events are synced to, such as Google
+// Calendar (see GoogleCalendarSink) or a CalDAV collection. syncSink diffs it
+// against Strava and calls Create, Update and Delete for each change
+type CalendarSink interface {
+	// Name identifies the calendar in logs and sync reports
+	Name() string
+	// ListManaged returns the events this tool created on the calendar
+	ListManaged(ctx context.Context) ([]sinkEvent, error)
+	// Changes describes each field of existing that differs from what would be
+	// written for event, or returns nil when it is up to date
+	Changes(existing sinkEvent, event Event) []string
+	// Create adds event to the calendar
+	Create(ctx context.Context, event Event) error
+	// Update replaces existing with event
+	Update(ctx context.Context, existing sinkEvent, event Event) error
+	// Delete removes an event
+	Delete(ctx context.Context, existing sinkEvent) error
+}
+
+// manualEventAdopter is a CalendarSink that can take over an event created by
+// hand for the same occurrence, rather than creating a duplicate
+type manualEventAdopter interface {
+	// FindManual returns the event created by hand for event, or nil
+	FindManual(event Event) *sinkEvent
+	// Adopt rewrites manual as event
+	Adopt(ctx context.Context, manual sinkEvent, event Event) error
+}
+
+// batchingSink is a CalendarSink that queues changes and sends them together
+// Create, Update, Delete and Adopt only queue; Flush sends them and returns the
+// error of each in the order they were queued, calling onBatch with the queue
+// indexes of each batch that succeeded
+type batchingSink interface {
+	Flush(ctx context.Context, onBatch func(done []int)) []error
+}
+
+// sinkEvent is an event this tool wrote to a CalendarSink
+type sinkEvent struct {
+	UID         string
+	Title       string
+	Href        string // Where the calendar stores the event
+	ETag        string // For conditional writes, empty when the calendar has none
+	Fingerprint string // Of the content last written, empty if unknown
+	Native      any    // The calendar's own event, e.g. a *calendar.Event
+}
+
+// plannedChange is one change planSync found between a calendar and Strava
+type plannedChange struct {
+	action   string    // "create", "update", "delete" or "skip"
+	uid      string    // The occurrence's UID (see eventUID)
+	event    Event     // The Strava occurrence, unset for deletes
+	existing sinkEvent // The calendar's event, unset for creates
+	changes  []string  // Each field that differs, for updates
+}
+
+// planSync diffs the events this tool created on a calendar against the Strava
+// occurrences, matching them by UID. Existing events are updated when changes
+// reports a difference and deleted when their occurrence is gone; cancelled
+// occurrences are left out so they are deleted too. The plan follows the order
+// of existing, followed by the creates in the order of events
+func planSync(existing []sinkEvent, events []Event, changes func(sinkEvent, Event) []string) []plannedChange {
+	stravaEventMap := make(map[string]Event)
+	for _, event := range events {
+		if event.CancelledAt != nil {
+			continue
+		}
+		stravaEventMap[eventUID(event)] = event
+	}
+
+	var plan []plannedChange
+	processedUIDs := make(map[string]bool)
+	for _, calendarEvent := range existing {
+		stravaEvent, exists := stravaEventMap[calendarEvent.UID]
+		if !exists {
+			plan = append(plan, plannedChange{action: "delete", uid: calendarEvent.UID, existing: calendarEvent})
+			continue
+		}
+		processedUIDs[calendarEvent.UID] = true
+
+		planned := plannedChange{action: "skip", uid: calendarEvent.UID, event: stravaEvent, existing: calendarEvent}
+		if planned.changes = changes(calendarEvent, stravaEvent); len(planned.changes) > 0 {
+			planned.action = "update"
+		}
+		plan = append(plan, planned)
+	}
+
+	for _, event := range events {
+		if event.CancelledAt == nil && !processedUIDs[eventUID(event)] {
+			plan = append(plan, plannedChange{action: "create", uid: eventUID(event), event: event})
+		}
+	}
+	return plan
+}
+
+// syncSink synchronizes Strava events with a CalendarSink
+// - Creates new events that don't exist, or adopts matching manual events
+// - Updates existing events that have changed
+// - Deletes events that no longer exist on Strava
+// When dryRun is true the changes are only logged, along with the fields that
+// triggered each update. checkpoint, when set, records the UIDs of changes as
+// they succeed, and creates and deletes it already records aren't repeated. Failed changes
+// don't stop the sync, and are reported together at the end; the returned
+// report is set whenever the diff completed
+func syncSink(ctx context.Context, sink CalendarSink, events []Event, dryRun bool, checkpoint *syncCheckpoint) (*SyncReport, error) {
+	report := &SyncReport{RunAt: time.Now().UTC(), CalendarID: sink.Name(), DryRun: dryRun}
+
+	existing, err := sink.ListManaged(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve existing %s events: %w", sink.Name(), err)
+	}
+	plan := planSync(existing, events, sink.Changes)
+
+	adopter, _ := sink.(manualEventAdopter)
+	batcher, batching := sink.(batchingSink)
+
+	// Changes sent in batches are reported once they have all been sent, with
+	// the report entry for each queued change at the same index
+	var syncErrors []error
+	var pending []int
+	for _, planned := range plan {
+		stravaEvent := planned.event
+		outcome := SyncEventOutcome{UID: planned.uid, EventID: stravaEvent.ID, Title: stravaEvent.Title, Action: planned.action}
+		startLocal := stravaEvent.Start.In(eventLocation(stravaEvent))
+
+		// Created or deleted by the interrupted sync this one resumes, though the
+		// calendar doesn't list it that way yet. Updates are still made, since a
+		// done event that differs was changed on Strava after the interruption
+		if outcome.Action != "skip" && len(planned.changes) == 0 && checkpoint.isDone(planned.uid) {
+			slog.Debug("Skipping change made before the sync was interrupted", "action", outcome.Action, "uid", planned.uid)
+			outcome.Action = "skip"
+		}
+
+		var manual *sinkEvent
+		if planned.action == "create" && adopter != nil {
+			if manual = adopter.FindManual(stravaEvent); manual != nil {
+				outcome.Action = "adopt"
+			}
+		}
+
+		if dryRun {
+			switch outcome.Action {
+			case "delete":
+				slog.Info("Would delete event (no longer on Strava)", "action", "delete", "dry_run", true, "uid", planned.uid, "title", planned.existing.Title)
+			case "update":
+				slog.Info("Would update event", "action", "update", "dry_run", true, "event_id", stravaEvent.ID, "uid", planned.uid,
+					"title", stravaEvent.Title, "start", startLocal.Format("Mon 2 Jan"))
+				for _, change := range planned.changes {
+					slog.Info("  changed "+change, "uid", planned.uid)
+				}
+			case "adopt":
+				slog.Info("Would adopt manually created event", "action", "adopt", "dry_run", true, "event_id", stravaEvent.ID,
+					"uid", planned.uid, "title", manual.Title)
+			case "create":
+				slog.Info("Would create event", "action", "create", "dry_run", true, "event_id", stravaEvent.ID, "uid", planned.uid,
+					"title", stravaEvent.Title, "start", startLocal.Format("Mon 2 Jan"))
+			}
+		}
+		switch outcome.Action {
+		case "delete":
+			outcome.Title = planned.existing.Title
+		case "update":
+			outcome.Changes = changedFields(planned.changes)
+		}
+		if dryRun || outcome.Action == "skip" {
+			report.Events = append(report.Events, outcome)
+			continue
+		}
+
+		// Stop once the run is cancelled or out of time, rather than failing every change
+		if !batching {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+		}
+		switch outcome.Action {
+		case "delete":
+			err = sink.Delete(ctx, planned.existing)
+		case "update":
+			for _, change := range planned.changes {
+				slog.Debug("  changed "+change, "uid", planned.uid)
+			}
+			err = sink.Update(ctx, planned.existing, stravaEvent)
+		case "adopt":
+			err = adopter.Adopt(ctx, *manual, stravaEvent)
+		case "create":
+			err = sink.Create(ctx, stravaEvent)
+		}
+
+		if batching && err == nil {
+			pending = append(pending, len(report.Events))
+		} else if err != nil {
+			slog.Error("Failed to "+outcome.Action+" event", "action", outcome.Action, "calendar", sink.Name(),
+				"uid", planned.uid, "title", outcome.Title, "error", err)
+			outcome.Error = err.Error()
+			syncErrors = append(syncErrors, fmt.Errorf("%s event %s: %w", outcome.Action, planned.uid, err))
+		} else {
+			slog.Info("Synced event", "action", outcome.Action, "calendar", sink.Name(), "uid", planned.uid, "title", outcome.Title)
+			checkpoint.recordDone([]string{planned.uid})
+		}
+		report.Events = append(report.Events, outcome)
+	}
+
+	if batching && !dryRun {
+		onBatch := func(done []int) {
+			uids := make([]string, len(done))
+			for i, index := range done {
+				uids[i] = report.Events[pending[index]].UID
+			}
+			checkpoint.recordDone(uids)
+		}
+		for i, err := range batcher.Flush(ctx, onBatch) {
+			if err != nil {
+				report.Events[pending[i]].Error = err.Error()
+				syncErrors = append(syncErrors, err)
+			}
+		}
+	}
+
+	tallySyncReport(report)
+	printSyncSummary(report)
+
+	if len(syncErrors) > 0 {
+		return report, fmt.Errorf("%d calendar changes failed: %w", len(syncErrors), errors.Join(syncErrors...))
+	}
+	return report, nil
+}
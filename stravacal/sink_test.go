@@ -0,0 +1,335 @@
+package stravacal
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSink is a CalendarSink in memory. Events are up to date when their
+// title matches, and every change is recorded in calls, e.g. "create <uid>"
+type fakeSink struct {
+	events map[string]sinkEvent // By UID
+	manual map[string]sinkEvent // Events created by hand, by the UID they're for
+	errs   map[string]error     // Errors changes to a UID fail with
+	onCall func()               // Called after each change, when set
+	calls  []string
+}
+
+func newFakeSink(existing ...sinkEvent) *fakeSink {
+	sink := &fakeSink{events: make(map[string]sinkEvent), manual: make(map[string]sinkEvent), errs: make(map[string]error)}
+	for _, event := range existing {
+		sink.events[event.UID] = event
+	}
+	return sink
+}
+
+func (s *fakeSink) Name() string { return "fake" }
+
+func (s *fakeSink) ListManaged(ctx context.Context) ([]sinkEvent, error) {
+	var events []sinkEvent
+	for _, uid := range slices.Sorted(maps.Keys(s.events)) {
+		events = append(events, s.events[uid])
+	}
+	return events, nil
+}
+
+func (s *fakeSink) Changes(existing sinkEvent, event Event) []string {
+	if existing.Title != event.Title {
+		return []string{"title " + existing.Title + " -> " + event.Title}
+	}
+	return nil
+}
+
+func (s *fakeSink) Create(ctx context.Context, event Event) error {
+	return s.change("create", eventUID(event), sinkEvent{UID: eventUID(event), Title: event.Title})
+}
+
+func (s *fakeSink) Update(ctx context.Context, existing sinkEvent, event Event) error {
+	return s.change("update", existing.UID, sinkEvent{UID: existing.UID, Title: event.Title})
+}
+
+func (s *fakeSink) Delete(ctx context.Context, existing sinkEvent) error {
+	return s.change("delete", existing.UID, sinkEvent{})
+}
+
+func (s *fakeSink) FindManual(event Event) *sinkEvent {
+	if manual, ok := s.manual[eventUID(event)]; ok {
+		return &manual
+	}
+	return nil
+}
+
+func (s *fakeSink) Adopt(ctx context.Context, manual sinkEvent, event Event) error {
+	return s.change("adopt", eventUID(event), sinkEvent{UID: eventUID(event), Title: event.Title})
+}
+
+// change records a change to uid, storing event unless it is a delete
+func (s *fakeSink) change(action, uid string, event sinkEvent) error {
+	s.calls = append(s.calls, action+" "+uid)
+	if s.onCall != nil {
+		s.onCall()
+	}
+	if err := s.errs[uid]; err != nil {
+		return err
+	}
+	if action == "delete" {
+		delete(s.events, uid)
+	} else {
+		s.events[uid] = event
+	}
+	return nil
+}
+
+// sinkTestEvents returns occurrences of events 1 to 4 and their UIDs
+func sinkTestEvents() ([]Event, []string) {
+	start := time.Date(2030, 7, 2, 17, 30, 0, 0, time.UTC)
+	var events []Event
+	var uids []string
+	for id := int64(1); id <= 4; id++ {
+		event := testEvent(id, start.AddDate(0, 0, int(id)))
+		events = append(events, event)
+		uids = append(uids, eventUID(event))
+	}
+	return events, uids
+}
+
+func TestPlanSync(t *testing.T) {
+	withSettings(t, nil)
+	events, uids := sinkTestEvents()
+	cancelledAt := time.Date(2030, 7, 1, 0, 0, 0, 0, time.UTC)
+	cancelled := events[0]
+	cancelled.CancelledAt = &cancelledAt
+
+	tests := []struct {
+		name     string
+		existing []sinkEvent
+		events   []Event
+		want     []string // "<action> <uid>"
+	}{
+		{
+			name:   "empty calendar",
+			events: events[:2],
+			want:   []string{"create " + uids[0], "create " + uids[1]},
+		},
+		{
+			name:     "up to date",
+			existing: []sinkEvent{{UID: uids[0], Title: events[0].Title}},
+			events:   events[:1],
+			want:     []string{"skip " + uids[0]},
+		},
+		{
+			name:     "changed",
+			existing: []sinkEvent{{UID: uids[0], Title: "Old title"}},
+			events:   events[:1],
+			want:     []string{"update " + uids[0]},
+		},
+		{
+			name:     "gone from Strava",
+			existing: []sinkEvent{{UID: uids[0], Title: events[0].Title}},
+			want:     []string{"delete " + uids[0]},
+		},
+		{
+			name:     "cancelled occurrence",
+			existing: []sinkEvent{{UID: uids[0], Title: events[0].Title}},
+			events:   []Event{cancelled},
+			want:     []string{"delete " + uids[0]},
+		},
+		{
+			name:   "cancelled occurrence not on the calendar",
+			events: []Event{cancelled},
+		},
+		{
+			name: "every action",
+			existing: []sinkEvent{
+				{UID: uids[0], Title: events[0].Title},
+				{UID: uids[1], Title: "Old title"},
+				{UID: uids[2], Title: events[2].Title},
+			},
+			events: []Event{events[3], events[1], events[0]},
+			want:   []string{"skip " + uids[0], "update " + uids[1], "delete " + uids[2], "create " + uids[3]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, planned := range planSync(tt.existing, tt.events, newFakeSink().Changes) {
+				got = append(got, planned.action+" "+planned.uid)
+				if planned.action == "update" && len(planned.changes) == 0 {
+					t.Errorf("update of %s has no changes", planned.uid)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("planSync = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncSink(t *testing.T) {
+	withSettings(t, nil)
+	events, uids := sinkTestEvents()
+
+	sink := newFakeSink(
+		sinkEvent{UID: uids[0], Title: events[0].Title},
+		sinkEvent{UID: uids[1], Title: "Old title"},
+		sinkEvent{UID: uids[2], Title: events[2].Title},
+	)
+	report, err := syncSink(context.Background(), sink, []Event{events[0], events[1], events[3]}, false, nil)
+	if err != nil {
+		t.Fatalf("syncSink: %v", err)
+	}
+
+	wantCalls := []string{"update " + uids[1], "delete " + uids[2], "create " + uids[3]}
+	if !slices.Equal(sink.calls, wantCalls) {
+		t.Errorf("changes = %q, want %q", sink.calls, wantCalls)
+	}
+	if report.Created != 1 || report.Updated != 1 || report.Deleted != 1 || report.Skipped != 1 || report.Failed != 0 {
+		t.Errorf("report counts %+v, want one of each change", report)
+	}
+
+	// Synced again, everything is up to date
+	sink.calls = nil
+	if _, err := syncSink(context.Background(), sink, []Event{events[0], events[1], events[3]}, false, nil); err != nil {
+		t.Fatalf("second syncSink: %v", err)
+	}
+	if len(sink.calls) > 0 {
+		t.Errorf("second sync made changes %q, want none", sink.calls)
+	}
+}
+
+func TestSyncSinkDryRun(t *testing.T) {
+	withSettings(t, nil)
+	events, uids := sinkTestEvents()
+
+	sink := newFakeSink(sinkEvent{UID: uids[1], Title: "Old title"}, sinkEvent{UID: uids[2]})
+	report, err := syncSink(context.Background(), sink, events[:2], true, nil)
+	if err != nil {
+		t.Fatalf("syncSink: %v", err)
+	}
+	if len(sink.calls) > 0 {
+		t.Errorf("dry run made changes %q", sink.calls)
+	}
+	if !report.DryRun || report.Created != 1 || report.Updated != 1 || report.Deleted != 1 {
+		t.Errorf("dry run report %+v, want a create, update and delete", report)
+	}
+}
+
+func TestSyncSinkCancelledOccurrence(t *testing.T) {
+	withSettings(t, nil)
+	events, uids := sinkTestEvents()
+	cancelledAt := time.Date(2030, 7, 1, 0, 0, 0, 0, time.UTC)
+	events[0].CancelledAt = &cancelledAt
+
+	sink := newFakeSink(sinkEvent{UID: uids[0], Title: events[0].Title})
+	if _, err := syncSink(context.Background(), sink, events[:1], false, nil); err != nil {
+		t.Fatalf("syncSink: %v", err)
+	}
+	if want := []string{"delete " + uids[0]}; !slices.Equal(sink.calls, want) {
+		t.Errorf("changes = %q, want %q", sink.calls, want)
+	}
+	if len(sink.events) != 0 {
+		t.Errorf("calendar still has %v", sink.events)
+	}
+}
+
+func TestSyncSinkAdopt(t *testing.T) {
+	withSettings(t, nil)
+	events, uids := sinkTestEvents()
+
+	sink := newFakeSink()
+	sink.manual[uids[0]] = sinkEvent{UID: "hand-made", Title: "tuesday tempo"}
+	report, err := syncSink(context.Background(), sink, events[:2], false, nil)
+	if err != nil {
+		t.Fatalf("syncSink: %v", err)
+	}
+	if want := []string{"adopt " + uids[0], "create " + uids[1]}; !slices.Equal(sink.calls, want) {
+		t.Errorf("changes = %q, want %q", sink.calls, want)
+	}
+	if report.Events[0].Action != "adopt" || report.Updated != 1 || report.Created != 1 {
+		t.Errorf("report %+v, want the adopt counted as an update", report)
+	}
+}
+
+func TestSyncSinkChangeErrors(t *testing.T) {
+	withSettings(t, nil)
+	events, uids := sinkTestEvents()
+
+	sink := newFakeSink(sinkEvent{UID: uids[0], Title: "Old title"}, sinkEvent{UID: uids[2]})
+	sink.errs[uids[0]] = errors.New("conflict")
+	report, err := syncSink(context.Background(), sink, events[:2], false, nil)
+
+	// A failed change doesn't stop the others
+	if err == nil || !strings.Contains(err.Error(), "1 calendar changes failed") || !strings.Contains(err.Error(), "conflict") {
+		t.Errorf("syncSink error = %v, want the failed update", err)
+	}
+	wantCalls := []string{"update " + uids[0], "delete " + uids[2], "create " + uids[1]}
+	if !slices.Equal(sink.calls, wantCalls) {
+		t.Errorf("changes = %q, want %q", sink.calls, wantCalls)
+	}
+	if report == nil || report.Failed != 1 || report.Deleted != 1 || report.Created != 1 {
+		t.Fatalf("report %+v, want one failure, delete and create", report)
+	}
+	if report.Events[0].UID != uids[0] || report.Events[0].Error != "conflict" {
+		t.Errorf("report event %+v, want the update's error", report.Events[0])
+	}
+}
+
+func TestSyncSinkCancelled(t *testing.T) {
+	withSettings(t, nil)
+	events, uids := sinkTestEvents()
+
+	// Cancelled after the first change, the rest aren't attempted
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := newFakeSink()
+	sink.onCall = cancel
+	report, err := syncSink(ctx, sink, events[:3], false, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("syncSink error = %v, want context.Canceled", err)
+	}
+	if want := []string{"create " + uids[0]}; !slices.Equal(sink.calls, want) {
+		t.Errorf("changes = %q, want %q", sink.calls, want)
+	}
+	if report == nil || len(report.Events) != 1 {
+		t.Errorf("report %+v, want the change made before cancelling", report)
+	}
+}
+
+func TestOccurrencesRoundTrip(t *testing.T) {
+	withSettings(t, nil)
+	withMemStore(t, &memStore{})
+
+	// A weekly event with two occurrences in the window
+	se := StravaEvent{ID: 42, Title: "Tuesday Tempo", ActivityType: "Run", Zone: "Europe/London",
+		UpcomingOccurrences: []string{"2030-07-02T17:30:00Z", "2030-07-09T17:30:00Z"}}
+	events, err := convertStravaEvent(se, "123")
+	if err != nil {
+		t.Fatalf("convertStravaEvent: %v", err)
+	}
+	if err := saveEvents(events); err != nil {
+		t.Fatalf("saveEvents: %v", err)
+	}
+	loaded, err := loadExistingEvents()
+	if err != nil {
+		t.Fatalf("loadExistingEvents: %v", err)
+	}
+
+	var synced []sinkEvent
+	for _, event := range loaded {
+		synced = append(synced, sinkEvent{UID: eventUID(event), Title: event.Title})
+	}
+	if len(synced) != 2 || synced[0].UID == synced[1].UID {
+		t.Fatalf("occurrence UIDs = %+v, want two distinct UIDs", synced)
+	}
+
+	for _, planned := range planSync(synced, loaded, newFakeSink().Changes) {
+		if planned.action != "skip" {
+			t.Errorf("planSync would %s %s, want every occurrence up to date", planned.action, planned.uid)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package stravacal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sqliteFile is the SQLite event store, relative to OUTPUT_DIR
+const sqliteFile = "events/events.db"
+
+// EventStore persists the event cache between runs
+// Load returns the events as they were saved; redaction and filtering are
+// applied by loadExistingEvents so every store behaves the same
+type EventStore interface {
+	Load() ([]Event, error)
+	Save(events []Event) error
+}
+
+// eventStores opens the store for each STORE value. The SQLite store adds
+// itself when built with -tags sqlite
+var eventStores = map[string]func() (EventStore, error){
+	"json": func() (EventStore, error) { return jsonStore{}, nil },
+}
+
+// getStore returns where the event cache is kept, from STORE:
+// - "json" (default): output/events/events.json
+// - "sqlite": output/events/events.db, keeping deleted events and sync times
+func getStore() (string, error) {
+	store := strings.ToLower(getenv("STORE"))
+	switch store {
+	case "":
+		return "json", nil
+	case "json", "sqlite":
+		if _, ok := eventStores[store]; !ok {
+			return "", fmt.Errorf("STORE=%s needs a build with -tags %s", store, store)
+		}
+		return store, nil
+	default:
+		return "", fmt.Errorf("STORE must be json or sqlite, got %q", store)
+	}
+}
+
+// openEventStore returns the configured event store
+func openEventStore() (EventStore, error) {
+	return eventStores[validated().store]()
+}
+
+// eventStorePath returns the file the configured event store is kept in, for logging
+func eventStorePath() string {
+	if validated().store == "sqlite" {
+		return outputPath(sqliteFile)
+	}
+	return outputPath(eventsFile)
+}
+
+// loadExistingEvents loads events from the event store
+func loadExistingEvents() ([]Event, error) {
+	store, err := openEventStore()
+	if err != nil {
+		return nil, err
+	}
+	events, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Apply phone number and email redaction to loaded events, and drop events
+	// excluded by the current filters so they are removed from the calendars
+	// rather than kept as cancelled
+	var included []Event
+	for _, event := range events {
+		if !includeEvent(event) {
+			continue
+		}
+		event.Description = redactEmails(redactPhoneNumbers(event.Description))
+		included = append(included, event)
+	}
+
+	return included, nil
+}
+
+// saveEvents saves events to the event store
+func saveEvents(events []Event) error {
+	store, err := openEventStore()
+	if err != nil {
+		return err
+	}
+	return store.Save(events)
+}
+
+// jsonStore keeps the event cache in a JSON file, the default store
+type jsonStore struct{}
+
+// Load reads the JSON cache file, returning no events if it doesn't exist yet
+func (jsonStore) Load() ([]Event, error) {
+	data, err := os.ReadFile(outputPath(eventsFile))
+	if os.IsNotExist(err) {
+		return []Event{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events file: %w", err)
+	}
+
+	var events []Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse events: %w", err)
+	}
+	return events, nil
+}
+
+// Save replaces the JSON cache file with events
+func (jsonStore) Save(events []Event) error {
+	data, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	if err := writeOutputFile(eventsFile, data); err != nil {
+		return fmt.Errorf("failed to write events file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+//go:build sqlite
+
+package stravacal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema keeps one row per occurrence, including ones that have left the
+// cache, so the history of each event can be queried:
+// - first_seen_at and last_synced_at are when it was first and last saved
+// - deleted_at is set when it drops out of the cache and cleared if it returns
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS events (
+	uid            TEXT PRIMARY KEY,
+	event_id       INTEGER NOT NULL,
+	title          TEXT NOT NULL,
+	start          TEXT NOT NULL,
+	data           TEXT NOT NULL,
+	first_seen_at  TEXT NOT NULL,
+	last_synced_at TEXT NOT NULL,
+	deleted_at     TEXT
+);
+CREATE INDEX IF NOT EXISTS events_event_id ON events (event_id);
+`
+
+func init() {
+	eventStores["sqlite"] = func() (EventStore, error) { return sqliteStore{path: outputPath(sqliteFile)}, nil }
+}
+
+// sqliteStore keeps the event cache in an SQLite database, soft-deleting
+// events instead of forgetting them
+type sqliteStore struct {
+	path string
+}
+
+// open opens the database, creating it and its schema if needed
+func (s sqliteStore) open() (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create event store directory: %w", err)
+	}
+	db, err := sql.Open("sqlite", s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event store: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create event store schema: %w", err)
+	}
+	return db, nil
+}
+
+// Load returns the events that aren't soft-deleted, newest first like the JSON cache
+func (s sqliteStore) Load() ([]Event, error) {
+	db, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT data FROM events WHERE deleted_at IS NULL ORDER BY start DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query event store: %w", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read event store: %w", err)
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return nil, fmt.Errorf("failed to parse stored event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event store: %w", err)
+	}
+	return events, nil
+}
+
+// Save upserts events and soft-deletes stored events that aren't among them,
+// in one transaction
+func (s sqliteStore) Save(events []Event) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start event store transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	saved := make(map[string]bool)
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event %d: %w", event.ID, err)
+		}
+		uid := eventUID(event)
+		saved[uid] = true
+		_, err = tx.Exec(`
+			INSERT INTO events (uid, event_id, title, start, data, first_seen_at, last_synced_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (uid) DO UPDATE SET
+				title = excluded.title,
+				start = excluded.start,
+				data = excluded.data,
+				last_synced_at = excluded.last_synced_at,
+				deleted_at = NULL`,
+			uid, event.ID, event.Title, event.Start.UTC().Format(time.RFC3339), string(data), now, now)
+		if err != nil {
+			return fmt.Errorf("failed to save event %d: %w", event.ID, err)
+		}
+	}
+
+	// Soft-delete whatever is no longer cached
+	rows, err := tx.Query(`SELECT uid FROM events WHERE deleted_at IS NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to query event store: %w", err)
+	}
+	var removed []string
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read event store: %w", err)
+		}
+		if !saved[uid] {
+			removed = append(removed, uid)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read event store: %w", err)
+	}
+	for _, uid := range removed {
+		if _, err := tx.Exec(`UPDATE events SET deleted_at = ? WHERE uid = ?`, now, uid); err != nil {
+			return fmt.Errorf("failed to mark event %s deleted: %w", uid, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit event store: %w", err)
+	}
+	return nil
+}
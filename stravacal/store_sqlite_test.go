@@ -0,0 +1,91 @@
+//go:build sqlite
+
+package stravacal
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreSoftDeletes(t *testing.T) {
+	withSettings(t, map[string]string{"STORE": "sqlite", "OUTPUT_DIR": t.TempDir()})
+
+	store, err := openEventStore()
+	if err != nil {
+		t.Fatalf("openEventStore: %v", err)
+	}
+	events, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load from a new store: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("new store has %d events, want none", len(events))
+	}
+
+	early := testEvent(1, time.Date(2030, 7, 2, 17, 30, 0, 0, time.UTC))
+	late := testEvent(2, time.Date(2030, 7, 9, 17, 30, 0, 0, time.UTC))
+	if err := store.Save([]Event{early, late}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	events, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(events) != 2 || events[0].ID != 2 || events[1].ID != 1 {
+		t.Fatalf("Load = %+v, want events 2 then 1", events)
+	}
+	if !events[1].Start.Equal(early.Start) || events[1].Title != early.Title {
+		t.Errorf("loaded %q at %v, want %q at %v", events[1].Title, events[1].Start, early.Title, early.Start)
+	}
+
+	// Saving without event 2 hides it from Load but keeps its row
+	early.Title = "Tuesday Tempo (moved)"
+	if err := store.Save([]Event{early}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	events, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(events) != 1 || events[0].Title != early.Title {
+		t.Fatalf("Load = %+v, want just the updated event 1", events)
+	}
+	if deleted := deletedAt(t, late); !deleted.Valid {
+		t.Errorf("event 2 has no deleted_at after leaving the cache")
+	}
+	if deleted := deletedAt(t, early); deleted.Valid {
+		t.Errorf("event 1 deleted_at = %q, want it still cached", deleted.String)
+	}
+
+	// Saving event 2 again restores it
+	if err := store.Save([]Event{early, late}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if deleted := deletedAt(t, late); deleted.Valid {
+		t.Errorf("event 2 deleted_at = %q after returning, want it cleared", deleted.String)
+	}
+	events, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("Load = %+v, want both events", events)
+	}
+}
+
+// deletedAt reads the deleted_at column of event from the SQLite store
+func deletedAt(t *testing.T, event Event) sql.NullString {
+	t.Helper()
+	db, err := sql.Open("sqlite", outputPath(sqliteFile))
+	if err != nil {
+		t.Fatalf("open event store: %v", err)
+	}
+	defer db.Close()
+
+	var deleted sql.NullString
+	if err := db.QueryRow(`SELECT deleted_at FROM events WHERE uid = ?`, eventUID(event)).Scan(&deleted); err != nil {
+		t.Fatalf("query event %s: %v", eventUID(event), err)
+	}
+	return deleted
+}
@@ -0,0 +1,77 @@
+package stravacal
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// memStore keeps the event cache in memory
+type memStore struct {
+	events []Event
+}
+
+// Load returns a copy of the saved events
+func (s *memStore) Load() ([]Event, error) {
+	return slices.Clone(s.events), nil
+}
+
+// Save replaces the saved events with a copy of events
+func (s *memStore) Save(events []Event) error {
+	s.events = slices.Clone(events)
+	return nil
+}
+
+// withMemStore makes store the event cache for the rest of the test
+func withMemStore(t *testing.T, store *memStore) {
+	t.Helper()
+	previous := eventStores["json"]
+	eventStores["json"] = func() (EventStore, error) { return store, nil }
+	t.Cleanup(func() { eventStores["json"] = previous })
+}
+
+func TestSaveAndLoadExistingEvents(t *testing.T) {
+	withSettings(t, map[string]string{"EXCLUDE_EVENT_IDS": "3"})
+	store := &memStore{}
+	withMemStore(t, store)
+
+	start := time.Date(2030, 7, 2, 17, 30, 0, 0, time.UTC)
+	kept := testEvent(1, start)
+	kept.Description = "Questions to sam@example.com or 07801 252100"
+	excluded := testEvent(3, start)
+
+	if err := saveEvents([]Event{kept, excluded}); err != nil {
+		t.Fatalf("saveEvents: %v", err)
+	}
+	if len(store.events) != 2 {
+		t.Fatalf("store has %d events, want both saved", len(store.events))
+	}
+
+	events, err := loadExistingEvents()
+	if err != nil {
+		t.Fatalf("loadExistingEvents: %v", err)
+	}
+	if len(events) != 1 || events[0].ID != 1 {
+		t.Fatalf("loadExistingEvents = %+v, want just event 1", events)
+	}
+	want := "Questions to [Email Redacted] or [Phone Number Redacted]"
+	if events[0].Description != want {
+		t.Errorf("description = %q, want %q", events[0].Description, want)
+	}
+	if !events[0].Start.Equal(start) || eventUID(events[0]) != eventUID(kept) {
+		t.Errorf("loaded event %s at %v, want %s at %v", eventUID(events[0]), events[0].Start, eventUID(kept), start)
+	}
+}
+
+func TestLoadExistingEventsEmpty(t *testing.T) {
+	withSettings(t, nil)
+	withMemStore(t, &memStore{})
+
+	events, err := loadExistingEvents()
+	if err != nil {
+		t.Fatalf("loadExistingEvents: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("loadExistingEvents = %+v, want no events", events)
+	}
+}
@@ -0,0 +1,1302 @@
+package stravacal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	stravaAPIBase  = "https://www.strava.com/api/v3"
+	stravaTokenURL = "https://www.strava.com/oauth/token"
+
+	// tokenCacheFile holds the last access token, relative to OUTPUT_DIR; excluded from the GitHub Pages deploy
+	tokenCacheFile = "cache/strava_token.json"
+	// tokenExpiryMargin is how close to expiry a token is refreshed proactively
+	tokenExpiryMargin = 60 * time.Second
+
+	// defaultTimezone is used for events without a zone when DEFAULT_TIMEZONE is unset
+	defaultTimezone = "Europe/London"
+
+	// defaultEventDurationMinutes is the estimated event length when DEFAULT_EVENT_DURATION_MINUTES is unset
+	defaultEventDurationMinutes = 60
+
+	// Backoff when Strava responds 429 Too Many Requests
+	maxRateLimitRetries = 4
+	rateLimitBaseDelay  = 15 * time.Second
+	rateLimitMaxDelay   = 2 * time.Minute
+
+	// defaultFetchConcurrency is how many clubs are fetched at once when FETCH_CONCURRENCY
+	// is unset; kept small since every request counts against Strava's rate limits
+	defaultFetchConcurrency = 2
+
+	// defaultHTTPTimeout limits each Strava and Google request when HTTP_TIMEOUT is unset
+	defaultHTTPTimeout = 30 * time.Second
+	// maxIdleConnsPerHost keeps enough connections open for concurrent club fetches
+	// and calendar batches to reuse them, instead of Go's default of 2
+	maxIdleConnsPerHost = 10
+)
+
+// tokenMu serializes access token refreshes between clubs fetched concurrently
+var tokenMu sync.Mutex
+
+// apiTransport is shared by every Strava and Google Calendar client, so
+// connections are reused across pages, clubs and syncs rather than opened for
+// each request
+var (
+	apiTransport     http.RoundTripper
+	apiTransportOnce sync.Once
+)
+
+// getHTTPTimeout returns how long each Strava and Google request may take, from
+// HTTP_TIMEOUT as a duration, e.g. "45s" or "2m"
+func getHTTPTimeout() (time.Duration, error) {
+	value := getenv("HTTP_TIMEOUT")
+	if value == "" {
+		return defaultHTTPTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("HTTP_TIMEOUT must be a positive duration like 30s or 2m, got %q", value)
+	}
+	return timeout, nil
+}
+
+// httpClient returns a client for Strava and Google Calendar requests with the
+// HTTP_TIMEOUT of the Config in use
+func httpClient() *http.Client {
+	return newHTTPClient(validated().httpTimeout)
+}
+
+// newHTTPClient returns a client on apiTransport whose requests take at most timeout
+func newHTTPClient(timeout time.Duration) *http.Client {
+	apiTransportOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		apiTransport = transport
+	})
+	return &http.Client{Timeout: timeout, Transport: apiTransport}
+}
+
+// RateLimitError is returned when Strava's daily request limit is exhausted
+// Retrying is pointless until the daily window resets, so callers should abort
+type RateLimitError struct {
+	Usage int
+	Limit int
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("strava daily rate limit exhausted (%d/%d requests)", e.Usage, e.Limit)
+}
+
+// minInternationalPhoneDigits is the fewest digits (country code included) in a
+// +-prefixed international number, so short numbers like "+5 km" aren't redacted
+const minInternationalPhoneDigits = 8
+
+// Pre-compiled regex patterns for phone number redaction (for performance)
+var (
+	// UK numbers, always redacted when PHONE_REGION includes UK (the default)
+	phoneRedactionPatterns = []*regexp.Regexp{
+		// UK landlines with 4-digit area codes (0xxx xxx xxxx) - MUST come before mobile
+		regexp.MustCompile(`\b0[1-9]\d{2}[\s\-]*\d{3}[\s\-]*\d{4}\b`),
+		// UK mobile numbers starting with 07
+		regexp.MustCompile(`\b07\d{3}[\s\-]*\d{3}[\s\-]*\d{3}\b`),
+		// London numbers (020) - 3-digit area code with 4+4 digits
+		regexp.MustCompile(`\b020[\s\-]*\d{4}[\s\-]*\d{4}\b`),
+		// UK landlines with 3-digit area codes (0xx xxxx xxxx)
+		regexp.MustCompile(`\b0[1-9]\d{2}[\s\-]*\d{4}[\s\-]*\d{4}\b`),
+		// UK landlines - more flexible (catch remaining patterns)
+		regexp.MustCompile(`\b0[1-3]\d{2,3}[\s\-]*\d{3,4}[\s\-]*\d{3,4}\b`),
+		// International format +44
+		regexp.MustCompile(`\+44\s*(?:\(0\))?\s*[1-9]\d{1,3}[\s\-]*\d{3,4}[\s\-]*\d{3,4}\b`),
+		// Bracketed area codes like (020) xxxx xxxx
+		regexp.MustCompile(`\([0-9]{3,4}\)[\s\-]*\d{3,4}[\s\-]*\d{4}\b`),
+		// Continuous digits starting with 0 (10-11 digits) - catch-all
+		regexp.MustCompile(`\b0\d{9,10}\b`),
+	}
+
+	// Words next to a number that show it isn't a phone number, e.g. "order 0123456789"
+	// or "0123456789 steps". "number" or "no" in between is skipped, so "order number"
+	// counts but "phone number" doesn't
+	nonPhoneWordsBefore = []string{"order", "ref", "reference", "invoice", "booking", "ticket", "receipt", "id", "account"}
+	nonPhoneWordsAfter  = []string{"m", "km", "mi", "miles", "metres", "meters", "ft", "feet", "steps", "gbp", "usd", "eur", "pounds", "dollars"}
+
+	// US and Canadian (NANP) numbers like (555) 123-4567, 555.123.4567 or +1 555-123-4567
+	usPhoneRedactionPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?:\+1[\s.\-]*)?(?:\([2-9]\d{2}\)|\b[2-9]\d{2})[\s.\-]*\d{3}[\s.\-]*\d{4}\b`),
+	}
+
+	// Any number with a +<country code> prefix, like +33 6 12 34 56 78 or +49 30 1234567
+	// Matches with fewer than minInternationalPhoneDigits digits are left alone
+	internationalPhoneRedactionPattern = regexp.MustCompile(`\+\d{1,3}(?:[\s.\-]*\(0\))?(?:[\s.\-]*\d{1,4}){2,6}\b`)
+
+	oldRedactionPattern = regexp.MustCompile(`<Phone Number Redacted>`)
+	newRedactionPattern = regexp.MustCompile(`\[Phone Number Redacted\]`)
+
+	// Email addresses (RFC 5322 simplified: local part, @, dotted domain with TLD)
+	emailRedactionPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+)
+
+// getClubIDs returns every club to fetch events from, from STRAVA_CLUB_ID
+// Several clubs are given comma-separated, e.g. "123456,789012"
+func getClubIDs() ([]string, error) {
+	value := getenv("STRAVA_CLUB_ID")
+	if value == "" {
+		return nil, fmt.Errorf("STRAVA_CLUB_ID environment variable is not set")
+	}
+
+	var clubIDs []string
+	for _, part := range strings.Split(value, ",") {
+		clubID := strings.TrimSpace(part)
+		if clubID == "" {
+			return nil, fmt.Errorf("STRAVA_CLUB_ID must be club IDs separated by commas, got %q", value)
+		}
+		if !slices.Contains(clubIDs, clubID) {
+			clubIDs = append(clubIDs, clubID)
+		}
+	}
+	return clubIDs, nil
+}
+
+// getFetchConcurrency returns how many clubs are fetched from Strava at once,
+// from FETCH_CONCURRENCY
+func getFetchConcurrency() (int, error) {
+	value := getenv("FETCH_CONCURRENCY")
+	if value == "" {
+		return defaultFetchConcurrency, nil
+	}
+	concurrency, err := strconv.Atoi(value)
+	if err != nil || concurrency < 1 {
+		return 0, fmt.Errorf("FETCH_CONCURRENCY must be a positive integer, got %q", value)
+	}
+	return concurrency, nil
+}
+
+// eventCoordinates returns the latitude and longitude of an event's meeting point
+// ok is false if the event has no usable coordinates
+func eventCoordinates(event Event) (lat, lng float64, ok bool) {
+	if len(event.StartLatLng) < 2 {
+		return 0, 0, false
+	}
+	return event.StartLatLng[0], event.StartLatLng[1], true
+}
+
+// getMapURL returns a Google Maps link to the event's meeting point, or "" without coordinates
+func getMapURL(event Event) string {
+	lat, lng, ok := eventCoordinates(event)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("https://www.google.com/maps/search/?api=1&query=%f,%f", lat, lng)
+}
+
+// getEventDuration returns the estimated duration of an event of the given activity type
+// The Strava API provides no end time at all, so this is always an estimate:
+// - DEFAULT_EVENT_DURATION_MINUTES sets the default (60 minutes if unset)
+// - EVENT_DURATION_OVERRIDES sets per-activity minutes, e.g. "Run=90,Ride=180"
+func getEventDuration(activityType string) (time.Duration, error) {
+	minutes := defaultEventDurationMinutes
+	if value := getenv("DEFAULT_EVENT_DURATION_MINUTES"); value != "" {
+		m, err := strconv.Atoi(value)
+		if err != nil || m <= 0 {
+			return 0, fmt.Errorf("DEFAULT_EVENT_DURATION_MINUTES must be a positive integer, got %q", value)
+		}
+		minutes = m
+	}
+
+	if overrides := getenv("EVENT_DURATION_OVERRIDES"); overrides != "" {
+		// Parse every entry (not just the matching one) so bad config is always reported
+		for _, pair := range strings.Split(overrides, ",") {
+			overrideType, value, found := strings.Cut(pair, "=")
+			m, err := strconv.Atoi(strings.TrimSpace(value))
+			if !found || err != nil || m <= 0 {
+				return 0, fmt.Errorf("EVENT_DURATION_OVERRIDES entry %q must be <ActivityType>=<positive minutes>", pair)
+			}
+			if activityType != "" && strings.EqualFold(strings.TrimSpace(overrideType), activityType) {
+				minutes = m
+			}
+		}
+	}
+
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+// defaultActivityPaces are the average paces, in minutes per km, used to
+// estimate durations from route distance when ACTIVITY_PACES doesn't set one
+var defaultActivityPaces = map[string]float64{
+	"Run":  6,
+	"Walk": 12,
+	"Hike": 15,
+	"Ride": 2.5,
+}
+
+// getDurationMode returns how event durations are estimated, from DURATION_MODE:
+// - "fixed" (default): getEventDuration for the event's activity type
+// - "estimate-from-distance": the route distance at the activity's pace, or
+// the fixed duration for events without a route or known pace
+func getDurationMode() (string, error) {
+	mode := strings.ToLower(getenv("DURATION_MODE"))
+	switch mode {
+	case "":
+		return "fixed", nil
+	case "fixed", "estimate-from-distance":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("DURATION_MODE must be fixed or estimate-from-distance, got %q", mode)
+	}
+}
+
+// getActivityPaces returns the average pace in minutes per km of each activity
+// type, keyed in lower case, from ACTIVITY_PACES (e.g. "Run=6,Ride=2.5") on top
+// of defaultActivityPaces
+func getActivityPaces() (map[string]float64, error) {
+	paces := make(map[string]float64)
+	for activityType, pace := range defaultActivityPaces {
+		paces[strings.ToLower(activityType)] = pace
+	}
+
+	if value := getenv("ACTIVITY_PACES"); value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			activityType, value, found := strings.Cut(pair, "=")
+			pace, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if !found || err != nil || pace <= 0 || math.IsInf(pace, 0) {
+				return nil, fmt.Errorf("ACTIVITY_PACES entry %q must be <ActivityType>=<positive minutes per km>", pair)
+			}
+			paces[strings.ToLower(strings.TrimSpace(activityType))] = pace
+		}
+	}
+
+	return paces, nil
+}
+
+// distanceDuration estimates how long covering a route takes at the activity's
+// pace, rounded to the minute. Reports false unless DURATION_MODE is
+// estimate-from-distance and both the distance and a pace are known
+func distanceDuration(activityType string, meters float64) (time.Duration, bool) {
+	if validated().durationMode != "estimate-from-distance" || meters <= 0 {
+		return 0, false
+	}
+	pace, ok := validated().activityPaces[strings.ToLower(activityType)]
+	if !ok {
+		return 0, false
+	}
+	minutes := math.Round(meters / 1000 * pace)
+	return time.Duration(max(minutes, 1)) * time.Minute, true
+}
+
+// getEndTimeMode returns how event end times are published, from END_TIME:
+// - "estimated" (default): the start plus getEventDuration, labelled as an estimate
+// - "none": no end time (zero length), with the duration shown as TBC
+func getEndTimeMode() (string, error) {
+	mode := strings.ToLower(getenv("END_TIME"))
+	switch mode {
+	case "":
+		return "estimated", nil
+	case "estimated", "none":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("END_TIME must be estimated or none, got %q", mode)
+	}
+}
+
+// getEventVisibility returns how events are marked for people who can see the
+// calendar but not its event details, from EVENT_VISIBILITY:
+// - "strava" (default): private for Strava's private events, public otherwise
+// - "public" or "private": every event
+// - "default": left to the calendar's default, with no CLASS in the ICS file
+func getEventVisibility() (string, error) {
+	visibility := strings.ToLower(getenv("EVENT_VISIBILITY"))
+	switch visibility {
+	case "":
+		return "strava", nil
+	case "strava", "public", "private", "default":
+		return visibility, nil
+	default:
+		return "", fmt.Errorf("EVENT_VISIBILITY must be strava, public, private or default, got %q", visibility)
+	}
+}
+
+// eventVisibility returns "public" or "private" for an event, or "" to leave it
+// to the calendar's default
+func eventVisibility(event Event) string {
+	switch visibility := validated().visibility; visibility {
+	case "strava":
+		if event.Private {
+			return "private"
+		}
+		return "public"
+	case "default":
+		return ""
+	default:
+		return visibility
+	}
+}
+
+// hasEndTime reports whether an event is published with its estimated end time
+// All-day events always span their day
+func hasEndTime(event Event) bool {
+	return validated().endTimeMode != "none" || isAllDayEvent(event)
+}
+
+// publishedEnd returns the end time to publish for an event, its start when
+// END_TIME is none
+func publishedEnd(event Event) time.Time {
+	if !hasEndTime(event) {
+		return event.Start
+	}
+	return event.End
+}
+
+// formatDurationDetail returns the description line saying how long an event
+// lasts, since Strava never gives an end time. "" for all-day events
+func formatDurationDetail(event Event) string {
+	if isAllDayEvent(event) {
+		return ""
+	}
+	if !hasEndTime(event) {
+		return "Duration: TBC"
+	}
+	if _, ok := distanceDuration(event.ActivityType, event.Distance); ok {
+		return fmt.Sprintf("Duration: about %d min, approximate finish %s (from the route distance)",
+			int(event.End.Sub(event.Start).Minutes()), event.End.In(eventLocation(event)).Format("3:04 PM"))
+	}
+	return fmt.Sprintf("Duration: about %d min (estimated)", int(event.End.Sub(event.Start).Minutes()))
+}
+
+// getAllDayMidnightEvents reports whether events starting at midnight are shown as
+// all-day events, from ALL_DAY_MIDNIGHT_EVENTS (default true)
+func getAllDayMidnightEvents() (bool, error) {
+	value := getenv("ALL_DAY_MIDNIGHT_EVENTS")
+	if value == "" {
+		return true, nil
+	}
+	allDay, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("ALL_DAY_MIDNIGHT_EVENTS must be true or false, got %q", value)
+	}
+	return allDay, nil
+}
+
+// isAllDayEvent reports whether an event is shown as all day rather than at a time
+// Strava lists events without a meaningful time (e.g. socials) at exactly midnight local time
+func isAllDayEvent(event Event) bool {
+	if !validated().allDayMidnight {
+		return false
+	}
+	start := event.Start.In(eventLocation(event))
+	return start.Hour() == 0 && start.Minute() == 0 && start.Second() == 0
+}
+
+// getDefaultTimezone returns the timezone for events that don't carry their own zone
+func getDefaultTimezone() string {
+	if tz := getenv("DEFAULT_TIMEZONE"); tz != "" {
+		return tz
+	}
+	return defaultTimezone
+}
+
+// eventZone returns the IANA timezone name of an event
+// Events cached before zones were recorded fall back to the default timezone
+func eventZone(event Event) string {
+	if event.Zone != "" {
+		return event.Zone
+	}
+	return getDefaultTimezone()
+}
+
+// eventLocation returns the time.Location an event should be displayed in
+func eventLocation(event Event) *time.Location {
+	loc, err := time.LoadLocation(eventZone(event))
+	if err != nil {
+		slog.Warn("Unknown timezone, using UTC", "zone", eventZone(event), "event_id", event.ID)
+		return time.UTC
+	}
+	return loc
+}
+
+// loadTokens loads Strava OAuth credentials from environment variables
+// A cached access token from a previous run is reused if one is available
+func loadTokens() (*TokenStore, error) {
+	clientID := getenv("STRAVA_CLIENT_ID")
+	clientSecret, err := getSecret("CLIENT_SECRET")
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := getSecret("REFRESH_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+
+	if clientID == "" || clientSecret == "" || refreshToken == "" {
+		return nil, fmt.Errorf("missing required environment variables: STRAVA_CLIENT_ID, CLIENT_SECRET, REFRESH_TOKEN")
+	}
+
+	tokens := &TokenStore{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RefreshToken: refreshToken,
+	}
+
+	// A missing or corrupt cache just means we refresh on the first request
+	cached, err := loadCachedToken()
+	if err != nil {
+		slog.Warn("Ignoring token cache", "error", err)
+	} else if cached != nil {
+		tokens.AccessToken = cached.AccessToken
+		tokens.ExpiresAt = cached.ExpiresAt
+	}
+
+	return tokens, nil
+}
+
+// loadCachedToken reads the access token saved by a previous run
+// Returns nil without error if no cache file exists
+func loadCachedToken() (*CachedToken, error) {
+	data, err := os.ReadFile(outputPath(tokenCacheFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token cache: %w", err)
+	}
+
+	var cached CachedToken
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("failed to parse token cache: %w", err)
+	}
+	if cached.AccessToken == "" {
+		return nil, fmt.Errorf("token cache has no access token")
+	}
+
+	return &cached, nil
+}
+
+// saveCachedToken persists the current access token for reuse by later runs
+// The file is only readable by the owner since it holds a credential
+func saveCachedToken(tokens *TokenStore) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath(tokenCacheFile)), 0700); err != nil {
+		return fmt.Errorf("failed to create token cache directory: %w", err)
+	}
+
+	data, err := json.Marshal(CachedToken{
+		AccessToken: tokens.AccessToken,
+		ExpiresAt:   tokens.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal token cache: %w", err)
+	}
+
+	if err := os.WriteFile(outputPath(tokenCacheFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write token cache: %w", err)
+	}
+
+	return nil
+}
+
+// tokenExpired reports whether the access token is missing or about to expire
+func tokenExpired(tokens *TokenStore) bool {
+	if tokens.AccessToken == "" {
+		return true
+	}
+	return time.Now().Add(tokenExpiryMargin).Unix() >= tokens.ExpiresAt
+}
+
+// refreshTokens refreshes the Strava OAuth access token using the refresh token
+func refreshTokens(ctx context.Context, tokens *TokenStore) error {
+	payload := fmt.Sprintf(
+		`{"client_id":"%s","client_secret":"%s","grant_type":"refresh_token","refresh_token":"%s"}`,
+		tokens.ClientID, tokens.ClientSecret, tokens.RefreshToken,
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stravaTokenURL, strings.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to refresh tokens: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("token refresh failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	tokens.AccessToken = tokenResp.AccessToken
+	tokens.RefreshToken = tokenResp.RefreshToken
+	tokens.ExpiresAt = tokenResp.ExpiresAt
+
+	// Failing to cache only costs an extra refresh next run
+	if err := saveCachedToken(tokens); err != nil {
+		slog.Warn("Failed to cache access token", "error", err)
+	}
+
+	return nil
+}
+
+// makeAPIRequest makes an authenticated request to the Strava API
+// Refreshes the access token up front when it is about to expire, and again
+// if the API still rejects it
+func makeAPIRequest(ctx context.Context, tokens *TokenStore, url string) (*http.Response, error) {
+	tokenMu.Lock()
+	if tokenExpired(tokens) {
+		log.Println("Access token missing or about to expire, refreshing...")
+		if err := refreshTokens(ctx, tokens); err != nil {
+			tokenMu.Unlock()
+			return nil, fmt.Errorf("failed to refresh tokens: %w", err)
+		}
+	}
+	accessToken := tokens.AccessToken
+	tokenMu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	client := httpClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+
+		// Another club's request may have refreshed the token already
+		tokenMu.Lock()
+		if tokens.AccessToken == accessToken {
+			log.Println("Access token expired, refreshing...")
+			if err := refreshTokens(ctx, tokens); err != nil {
+				tokenMu.Unlock()
+				return nil, fmt.Errorf("failed to refresh tokens: %w", err)
+			}
+		}
+		accessToken = tokens.AccessToken
+		tokenMu.Unlock()
+
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retry request: %w", err)
+		}
+	}
+
+	// Back off and retry while rate limited, unless the daily limit is used up
+	for attempt := 0; resp.StatusCode == http.StatusTooManyRequests; attempt++ {
+		resp.Body.Close()
+
+		// Headers are "<15 minute>,<daily>" e.g. X-RateLimit-Usage: 100,350
+		usage := parseRateLimitHeader(resp.Header.Get("X-RateLimit-Usage"))
+		limit := parseRateLimitHeader(resp.Header.Get("X-RateLimit-Limit"))
+		if len(usage) == 2 && len(limit) == 2 && usage[1] >= limit[1] {
+			return nil, &RateLimitError{Usage: usage[1], Limit: limit[1]}
+		}
+
+		if attempt >= maxRateLimitRetries {
+			return nil, fmt.Errorf("still rate limited after %d retries", attempt)
+		}
+
+		delay := rateLimitBaseDelay << attempt
+		if delay > rateLimitMaxDelay {
+			delay = rateLimitMaxDelay
+		}
+		slog.Warn("Rate limited by Strava, retrying", "usage", usage, "limit", limit, "retry_in", delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retry request: %w", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// sleepContext waits for d, returning the context's error early if it is
+// cancelled or its deadline passes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// parseRateLimitHeader parses a comma-separated Strava rate limit header into integers
+// Returns nil if the header is missing or malformed
+func parseRateLimitHeader(value string) []int {
+	if value == "" {
+		return nil
+	}
+
+	var values []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil
+		}
+		values = append(values, n)
+	}
+	return values
+}
+
+// ClubFetchError is returned with the events of the clubs that were fetched when
+// others failed, so one failing club doesn't hold up the rest
+type ClubFetchError struct {
+	Errors map[string]error // By club ID
+}
+
+func (e *ClubFetchError) Error() string {
+	var messages []string
+	for _, clubID := range e.Clubs() {
+		messages = append(messages, fmt.Sprintf("club %s: %v", clubID, e.Errors[clubID]))
+	}
+	return "failed to fetch some clubs: " + strings.Join(messages, "; ")
+}
+
+func (e *ClubFetchError) Unwrap() []error {
+	var errs []error
+	for _, clubID := range e.Clubs() {
+		errs = append(errs, e.Errors[clubID])
+	}
+	return errs
+}
+
+// Clubs returns the IDs of the clubs that failed, sorted
+func (e *ClubFetchError) Clubs() []string {
+	clubIDs := make([]string, 0, len(e.Errors))
+	for clubID := range e.Errors {
+		clubIDs = append(clubIDs, clubID)
+	}
+	sort.Strings(clubIDs)
+	return clubIDs
+}
+
+// fetchClubsEvents fetches the events of each club, at most FETCH_CONCURRENCY
+// clubs at a time, returning them by club ID. upcoming is passed to fetchClubEvents
+// When only some clubs fail their errors are returned as a *ClubFetchError alongside
+// the events of the rest; when every club fails the error is returned alone
+func fetchClubsEvents(ctx context.Context, tokens *TokenStore, clubIDs []string, upcoming bool) (map[string][]StravaEvent, error) {
+	concurrency := validated().fetchConcurrency
+
+	results := make(map[string][]StravaEvent)
+	failures := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+
+	for _, clubID := range clubIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			events, err := fetchClubEvents(ctx, tokens, clubID, upcoming)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				slog.Error("Failed to fetch club events", "club_id", clubID, "error", err)
+				failures[clubID] = err
+				return
+			}
+			results[clubID] = events
+		}()
+	}
+	wg.Wait()
+
+	switch {
+	case len(failures) == 0:
+		return results, nil
+	case len(clubIDs) == 1:
+		return nil, failures[clubIDs[0]]
+	case len(failures) == len(clubIDs):
+		var errs []error
+		for _, clubID := range clubIDs {
+			errs = append(errs, fmt.Errorf("club %s: %w", clubID, failures[clubID]))
+		}
+		return nil, errors.Join(errs...)
+	default:
+		return results, &ClubFetchError{Errors: failures}
+	}
+}
+
+// fetchClubEvents retrieves club events from Strava using the undocumented endpoint
+// CRITICAL: The sync uses the upcoming=true parameter which is essential for filtering
+// Without upcoming it is left out, so events that have already happened are
+// returned too (see fetchPastEvents)
+// Rate limit impact: ~1 request per 200 events
+func fetchClubEvents(ctx context.Context, tokens *TokenStore, clubID string, upcoming bool) ([]StravaEvent, error) {
+	var allEvents []StravaEvent
+	seenIDs := make(map[int64]bool)
+	page := 1
+	perPage := 200 // Conservative to stay under rate limits
+
+	for {
+		// Stop between pages once the run is cancelled or out of time
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// UNDOCUMENTED ENDPOINT - not in official API docs but works
+		url := fmt.Sprintf("%s/clubs/%s/group_events?page=%d&per_page=%d", stravaAPIBase, clubID, page, perPage)
+		if upcoming {
+			url += "&upcoming=true"
+		}
+
+		resp, err := makeAPIRequest(ctx, tokens, url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		}
+
+		var events []StravaEvent
+		if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+			return nil, fmt.Errorf("failed to decode events: %w", err)
+		}
+
+		if len(events) == 0 {
+			break
+		}
+
+		// Pages occasionally overlap for recurring events, so keep only the first copy of each
+		for _, event := range events {
+			if seenIDs[event.ID] {
+				slog.Debug("Skipping duplicate event from later page", "event_id", event.ID, "page", page)
+				continue
+			}
+			seenIDs[event.ID] = true
+			allEvents = append(allEvents, event)
+		}
+
+		if len(events) < perPage {
+			break
+		}
+
+		page++
+		log.Printf("Fetched page %d, got %d events", page-1, len(events))
+	}
+
+	return allEvents, nil
+}
+
+// getActivityPrefixes returns the title prefix for each activity type, keyed
+// in lower case, from ACTIVITY_PREFIX_MAP, e.g. "Run=🏃,Ride=🚴"
+func getActivityPrefixes() (map[string]string, error) {
+	value := getenv("ACTIVITY_PREFIX_MAP")
+	if value == "" {
+		return nil, nil
+	}
+	prefixes := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		activityType, prefix, found := strings.Cut(pair, "=")
+		activityType, prefix = strings.TrimSpace(activityType), strings.TrimSpace(prefix)
+		if !found || activityType == "" || prefix == "" {
+			return nil, fmt.Errorf("ACTIVITY_PREFIX_MAP entry %q must be <ActivityType>=<prefix>", pair)
+		}
+		prefixes[strings.ToLower(activityType)] = prefix
+	}
+	return prefixes, nil
+}
+
+// calendarEventTitle returns the title an event is published with, e.g.
+// "🏃 Tuesday Social | Beginner", with its ACTIVITY_PREFIX_MAP prefix and skill
+// levels. The ICS file and Google Calendar share it, so syncs compare the same
+// title they write
+func calendarEventTitle(event Event) string {
+	title := event.Title
+
+	// Titles that already start with the prefix aren't given it twice
+	if prefix := validated().activityPrefixes[strings.ToLower(event.ActivityType)]; prefix != "" && !strings.HasPrefix(title, prefix) {
+		title = prefix + " " + title
+	}
+
+	if skillLevel := getSkillLevelString(event.SkillLevels); skillLevel != "" {
+		title = title + " | " + skillLevel
+	}
+	return title
+}
+
+// getSkillLevelString converts the skill level bitmask to a readable string
+// Strava combines levels as bit flags, e.g. 3 = Beginner + Intermediate
+func getSkillLevelString(skillLevels *int) string {
+	if skillLevels == nil {
+		return ""
+	}
+
+	var levels []string
+	if *skillLevels&1 != 0 {
+		levels = append(levels, "Beginner")
+	}
+	if *skillLevels&2 != 0 {
+		levels = append(levels, "Intermediate")
+	}
+	if *skillLevels&4 != 0 {
+		levels = append(levels, "Advanced")
+	}
+
+	if len(levels) == 3 {
+		return "All Levels"
+	}
+	return strings.Join(levels, ", ")
+}
+
+// getTerrainString converts the numeric terrain code to a readable string
+func getTerrainString(terrain *int) string {
+	if terrain == nil {
+		return ""
+	}
+	switch *terrain {
+	case 0:
+		return "Road"
+	case 1:
+		return "Trail"
+	case 2:
+		return "Mixed"
+	default:
+		return ""
+	}
+}
+
+// formatEventMetadata creates a formatted string combining skill level and terrain
+// Returns format: "Intermediate / Road" or empty string if both are nil
+func formatEventMetadata(skillLevels *int, terrain *int) string {
+	skill := getSkillLevelString(skillLevels)
+	terr := getTerrainString(terrain)
+
+	if skill != "" && terr != "" {
+		return skill + " / " + terr
+	} else if skill != "" {
+		return skill
+	} else if terr != "" {
+		return terr
+	}
+	return ""
+}
+
+// getUnits returns the units system for distances, from UNITS: "metric" (default) or "imperial"
+func getUnits() (string, error) {
+	units := strings.ToLower(getenv("UNITS"))
+	switch units {
+	case "":
+		return "metric", nil
+	case "metric", "imperial":
+		return units, nil
+	default:
+		return "", fmt.Errorf("UNITS must be metric or imperial, got %q", units)
+	}
+}
+
+// distanceUnit returns the name and length in meters of the configured distance unit
+func distanceUnit() (name string, meters float64) {
+	if validated().units == "imperial" {
+		return "mi", 1609.344
+	}
+	return "km", 1000
+}
+
+// formatDistance formats a distance in the configured units to one decimal place,
+// e.g. "5.0 km" or "3.1 mi". Returns "" for zero or unknown distances
+func formatDistance(meters float64) string {
+	if meters <= 0 || math.IsNaN(meters) || math.IsInf(meters, 0) {
+		return ""
+	}
+	unitName, unitMeters := distanceUnit()
+	return fmt.Sprintf("%.1f %s", meters/unitMeters, unitName)
+}
+
+// formatRouteDetails describes an event's route distance and estimated time, e.g.
+// ["Distance: 8.0 km", "Estimated time: 45 min (5:38 /km)"]. Empty without a route
+func formatRouteDetails(event Event) []string {
+	distance := formatDistance(event.Distance)
+	if distance == "" {
+		return nil
+	}
+
+	unitName, unitMeters := distanceUnit()
+	details := []string{"Distance: " + distance}
+	if event.MovingTime > 0 {
+		paceSeconds := int(float64(event.MovingTime) / (event.Distance / unitMeters))
+		details = append(details, fmt.Sprintf("Estimated time: %d min (%d:%02d /%s)",
+			(event.MovingTime+30)/60, paceSeconds/60, paceSeconds%60, unitName))
+	}
+	return details
+}
+
+// getPhoneRegions returns the phone number formats to redact from PHONE_REGION,
+// a comma-separated list of UK (the default), US and INTL (any +<country code> number)
+func getPhoneRegions() ([]string, error) {
+	value := getenv("PHONE_REGION")
+	if value == "" {
+		return []string{"UK"}, nil
+	}
+
+	var regions []string
+	for _, region := range strings.Split(value, ",") {
+		region = strings.ToUpper(strings.TrimSpace(region))
+		switch region {
+		case "UK", "US", "INTL":
+			regions = append(regions, region)
+		default:
+			return nil, fmt.Errorf("PHONE_REGION must be a comma-separated list of UK, US and INTL, got %q", region)
+		}
+	}
+	return regions, nil
+}
+
+// redactPhoneNumbers removes phone numbers from text and replaces them with "[Phone Number Redacted]".
+// It handles the formats of the regions in PHONE_REGION with optional punctuation, brackets, and spacing.
+// UK and US matches are kept when the context shows they aren't phone numbers (see redactUnlessNonPhone).
+// Examples matched for UK:
+//   - 07801 252100
+//   - 07341 081992
+//   - 07599393367
+//   - +44 7801 252100
+//   - +44 (0)7801-252-100
+//   - (020) 7946 0018
+//   - 0207-946-0018
+func redactPhoneNumbers(text string) string {
+	// First, clean up any existing redactions (both old and new formats)
+	text = oldRedactionPattern.ReplaceAllString(text, "[Phone Number Redacted]")
+	text = newRedactionPattern.ReplaceAllString(text, "[Phone Number Redacted]")
+
+	// Apply the phone number patterns for each region using pre-compiled regexes
+	result := text
+	for _, region := range validated().phoneRegions {
+		switch region {
+		case "UK":
+			for _, pattern := range phoneRedactionPatterns {
+				result = redactUnlessNonPhone(result, pattern)
+			}
+		case "US":
+			for _, pattern := range usPhoneRedactionPatterns {
+				result = redactUnlessNonPhone(result, pattern)
+			}
+		case "INTL":
+			result = redactInternationalPhoneNumbers(result)
+		}
+	}
+
+	return result
+}
+
+// redactInternationalPhoneNumbers redacts +-prefixed numbers with at least
+// minInternationalPhoneDigits digits
+func redactInternationalPhoneNumbers(text string) string {
+	return internationalPhoneRedactionPattern.ReplaceAllStringFunc(text, func(match string) string {
+		digits := 0
+		for _, r := range strings.Replace(match, "(0)", "", 1) { // The trunk prefix isn't dialled
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+		if digits < minInternationalPhoneDigits {
+			return match
+		}
+		return "[Phone Number Redacted]"
+	})
+}
+
+// redactAllPhoneNumbers redacts every phone number format regardless of PHONE_REGION,
+// without the context exceptions of redactUnlessNonPhone, for text shown publicly
+func redactAllPhoneNumbers(text string) string {
+	for _, pattern := range slices.Concat(phoneRedactionPatterns, usPhoneRedactionPatterns) {
+		text = pattern.ReplaceAllString(text, "[Phone Number Redacted]")
+	}
+	return redactInternationalPhoneNumbers(text)
+}
+
+// sanitizeForPublic returns a copy of event for the public calendar, without the
+// leader's name and with every phone number and email address redacted
+// It is treated as not private, so EVENT_VISIBILITY=strava shows it as public
+func sanitizeForPublic(event Event) Event {
+	event.Organizer = ""
+	event.Private = false
+	event.Description = redactEmails(redactAllPhoneNumbers(event.Description))
+	return event
+}
+
+// redactUnlessNonPhone replaces matches of pattern with "[Phone Number Redacted]",
+// except where the context shows the digits aren't a phone number:
+// - inside a URL
+// - after a currency symbol or "#"
+// - after a word like "order" or "ref", or before a unit or currency like "km" or "GBP"
+func redactUnlessNonPhone(text string, pattern *regexp.Regexp) string {
+	var result strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		before := text[:match[0]]
+		after := text[match[1]:]
+
+		// The whitespace-delimited word containing the match
+		wordStart := strings.LastIndexAny(before, " \t\r\n") + 1
+		prefix := before[wordStart:]
+		inURL := strings.Contains(prefix, "://") || strings.HasPrefix(prefix, "www.")
+
+		if inURL || strings.HasSuffix(prefix, "#") || strings.ContainsAny(prefix, "£$€") ||
+			slices.Contains(nonPhoneWordsBefore, lastWord(before)) || slices.Contains(nonPhoneWordsAfter, firstWord(after)) {
+			continue
+		}
+
+		result.WriteString(text[last:match[0]])
+		result.WriteString("[Phone Number Redacted]")
+		last = match[1]
+	}
+	result.WriteString(text[last:])
+
+	return result.String()
+}
+
+// lastWord returns the final word of text in lower case, without punctuation,
+// looking past a trailing "number" or "no" (as in "order number")
+func lastWord(text string) string {
+	fields := strings.Fields(text)
+	for i := len(fields) - 1; i >= 0; i-- {
+		word := strings.ToLower(strings.Trim(fields[i], ".:#-()"))
+		if (word != "number" && word != "no") || i == 0 {
+			return word
+		}
+	}
+	return ""
+}
+
+// firstWord returns the first word of text in lower case, without punctuation
+func firstWord(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.Trim(fields[0], ".,:;!?()"))
+}
+
+// decodeHTMLEntities replaces named and numeric (&#39; or &#x27;) HTML entities
+// with the characters they stand for; non-breaking spaces become plain spaces
+func decodeHTMLEntities(text string) string {
+	return strings.ReplaceAll(html.UnescapeString(text), "\u00a0", " ")
+}
+
+// redactEmails replaces email addresses in text with "[Email Redacted]"
+// Addresses that are part of a URL (e.g. https://user@host) or a mailto: link are
+// left alone, since those are links we generate rather than pasted contact details
+func redactEmails(text string) string {
+	var result strings.Builder
+	last := 0
+	for _, match := range emailRedactionPattern.FindAllStringIndex(text, -1) {
+		// Find the whitespace-delimited word containing the match
+		wordStart := strings.LastIndexAny(text[:match[0]], " \t\r\n") + 1
+		prefix := text[wordStart:match[0]]
+		if strings.Contains(prefix, "://") || strings.HasSuffix(prefix, "mailto:") {
+			continue
+		}
+
+		result.WriteString(text[last:match[0]])
+		result.WriteString("[Email Redacted]")
+		last = match[1]
+	}
+	result.WriteString(text[last:])
+
+	return result.String()
+}
+
+// convertStravaEvent transforms Strava API response to our standardized Event format
+// Key transformations:
+// - Each upcoming_occurrences entry becomes its own Event (recurring runs share one Strava event)
+// - Estimates end time from the configured duration since the API doesn't provide one
+// - Constructs proper Strava URL for the event
+// - Carries the event timezone (or the default timezone if Strava omits it)
+// - Decodes HTML entities in the title, description and address
+// - Redacts phone numbers and email addresses from description
+func convertStravaEvent(se StravaEvent, clubID string) ([]Event, error) {
+	if len(se.UpcomingOccurrences) == 0 {
+		return nil, fmt.Errorf("no upcoming occurrences for event %d", se.ID)
+	}
+
+	// Format organizer name from first and last name
+	organizer := decodeHTMLEntities(strings.TrimSpace(se.OrganizingAthlete.FirstName + " " + se.OrganizingAthlete.LastName))
+
+	// Calendars show a blank title as "(No title)", so generate one from
+	// fields that don't change between runs
+	title := decodeHTMLEntities(se.Title)
+	if strings.TrimSpace(title) == "" {
+		title = fallbackEventTitle(se.ActivityType, organizer)
+	}
+
+	// Strava doesn't provide end_date_local, so the end time is an estimate
+	duration, err := getEventDuration(se.ActivityType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the event's own timezone, falling back to the default if missing or unknown
+	zone := se.Zone
+	if _, err := time.LoadLocation(zone); zone == "" || err != nil {
+		zone = getDefaultTimezone()
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	// Route details are only available when a route is attached
+	var distance float64
+	var movingTime int
+	if se.Route != nil {
+		distance = se.Route.Distance
+		movingTime = se.Route.EstimatedMovingTime
+	}
+	if estimate, ok := distanceDuration(se.ActivityType, distance); ok {
+		duration = estimate
+	}
+
+	// Only keep coordinates when both latitude and longitude are present,
+	// falling back to an address that is just coordinates
+	var startLatLng []float64
+	if len(se.StartLatLng) >= 2 {
+		startLatLng = []float64{se.StartLatLng[0], se.StartLatLng[1]}
+	} else if lat, lng, ok := parseCoordinateAddress(se.Address); ok {
+		startLatLng = []float64{lat, lng}
+	}
+
+	var events []Event
+	for _, occurrence := range se.UpcomingOccurrences {
+		startTime, err := parseOccurrence(occurrence, location)
+		if err != nil {
+			// Skip just this occurrence so one bad timestamp doesn't drop the whole event
+			slog.Warn("Skipping occurrence with unparseable start time", "event_id", se.ID, "occurrence", occurrence, "error", err)
+			continue
+		}
+
+		endTime := startTime.Add(duration)
+
+		events = append(events, Event{
+			ID:           se.ID,
+			Title:        title,
+			Start:        startTime,
+			End:          endTime,
+			Description:  redactEmails(redactPhoneNumbers(decodeHTMLEntities(se.Description))),
+			URL:          fmt.Sprintf("https://www.strava.com/clubs/%s/group_events/%d", clubID, se.ID),
+			ClubID:       clubID,
+			Location:     decodeHTMLEntities(se.Address),
+			Organizer:    organizer,
+			ActivityType: se.ActivityType,
+			SkillLevels:  se.SkillLevels,
+			Terrain:      se.Terrain,
+			Zone:         zone,
+			StartLatLng:  startLatLng,
+			Distance:     distance,
+			MovingTime:   movingTime,
+			WomenOnly:    se.WomenOnly,
+			Private:      se.Private,
+			PhotoURL:     se.PhotoURL,
+			Attending:    se.AthleteCount,
+		})
+	}
+
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no occurrences with a valid start time for event %d", se.ID)
+	}
+
+	// Strava occasionally lists an occurrence that has already happened first.
+	// Every occurrence is kept (the filters drop old ones), but in start order so
+	// the first is the earliest and regular ones can repeat in the ICS file
+	firstListed := events[0].Start
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	if next := nextOccurrence(events, time.Now()); !next.Equal(firstListed) {
+		slog.Info("Strava's first occurrence isn't the next one", "event_id", se.ID,
+			"first_listed", firstListed.Format(time.RFC3339), "next", next.Format(time.RFC3339))
+	}
+
+	return events, nil
+}
+
+// nextOccurrence returns the earliest start of events, sorted by start, that is
+// after now, or the latest one if they have all started
+func nextOccurrence(events []Event, now time.Time) time.Time {
+	for _, event := range events {
+		if event.Start.After(now) {
+			return event.Start
+		}
+	}
+	return events[len(events)-1].Start
+}
+
+// occurrenceLayouts are the zoneless timestamp formats accepted in upcoming_occurrences,
+// tried after RFC 3339 (which covers "Z", numeric offsets and fractional seconds)
+var occurrenceLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+}
+
+// parseOccurrence parses an upcoming_occurrences timestamp as UTC
+// Strava sends "2025-10-18T08:00:00Z", but offsets and fractional seconds are
+// accepted too, and timestamps without a zone are taken to be in location
+func parseOccurrence(value string, location *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range occurrenceLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised timestamp %q", value)
+}
+
+// fallbackEventTitle builds a title for an event without one, e.g. "Run with Jane Smith"
+func fallbackEventTitle(activityType, organizer string) string {
+	title := "Club Event"
+	if activityType != "" {
+		title = activityType
+	}
+	if organizer != "" {
+		title += " with " + organizer
+	}
+	return title
+}
+
+// eventUID returns the iCalendar UID for a single occurrence of a Strava event
+// Format: <strava id>-<yyyymmdd>@strava.com, using the UTC date of the occurrence
+// so the UID stays stable as earlier occurrences of a recurring event drop off
+func eventUID(event Event) string {
+	return fmt.Sprintf("%d-%s@strava.com", event.ID, event.Start.UTC().Format("20060102"))
+}
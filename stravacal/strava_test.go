@@ -0,0 +1,428 @@
+package stravacal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withSettings makes a validated Config with settings the one in use for the
+// rest of the test
+func withSettings(t *testing.T, settings map[string]string) {
+	t.Helper()
+	t.Cleanup(use(Config{Settings: settings}))
+	if err := validateSettings(); err != nil {
+		t.Fatalf("settings %v: %v", settings, err)
+	}
+}
+
+// withStravaServer sends the Strava API requests of the rest of the test to handler
+func withStravaServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	target, _ := url.Parse(server.URL)
+	t.Cleanup(func() {
+		server.Close()
+		apiTransport, apiTransportOnce = nil, sync.Once{}
+	})
+
+	apiTransportOnce.Do(func() {})
+	apiTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/api/v3")
+		return http.DefaultTransport.RoundTrip(req)
+	})
+}
+
+// roundTripFunc is a function as an http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// testTokens are Strava tokens that don't need refreshing
+func testTokens() *TokenStore {
+	return &TokenStore{AccessToken: "token", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+}
+
+func TestRedactMixedContent(t *testing.T) {
+	withSettings(t, nil)
+
+	description := "Route: https://www.strava.com/routes/07801252100\n" +
+		"Questions to mailto:runs@example.com or sam.leader@example.com\n" +
+		"Call 07801 252100 if you're late"
+	want := "Route: https://www.strava.com/routes/07801252100\n" +
+		"Questions to mailto:runs@example.com or [Email Redacted]\n" +
+		"Call [Phone Number Redacted] if you're late"
+
+	if got := redactEmails(redactPhoneNumbers(description)); got != want {
+		t.Errorf("redacted description =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConvertStravaEventEmptyTitle(t *testing.T) {
+	withSettings(t, nil)
+
+	tests := []struct {
+		name         string
+		title        string
+		activityType string
+		firstName    string
+		lastName     string
+		want         string
+	}{
+		{"activity and organizer", "", "Run", "Jane", "Smith", "Run with Jane Smith"},
+		{"whitespace title", "   ", "Ride", "Jane", "", "Ride with Jane"},
+		{"no organizer", "", "Walk", "", "", "Walk"},
+		{"nothing known", "", "", "", "", "Club Event"},
+		{"title kept", "Tuesday Tempo", "Run", "Jane", "Smith", "Tuesday Tempo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			se := StravaEvent{ID: 1, Title: tt.title, ActivityType: tt.activityType, UpcomingOccurrences: []string{"2030-01-01T08:00:00Z"}}
+			se.OrganizingAthlete.FirstName = tt.firstName
+			se.OrganizingAthlete.LastName = tt.lastName
+
+			// The title must be the same every run so it doesn't trigger updates
+			for run := 0; run < 2; run++ {
+				events, err := convertStravaEvent(se, "123")
+				if err != nil {
+					t.Fatalf("convertStravaEvent: %v", err)
+				}
+				if events[0].Title != tt.want {
+					t.Errorf("run %d: title = %q, want %q", run+1, events[0].Title, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatDistance(t *testing.T) {
+	tests := []struct {
+		units  string
+		meters float64
+		want   string
+	}{
+		{"metric", 5000, "5.0 km"},
+		{"metric", 21097.5, "21.1 km"},
+		{"metric", 0, ""},
+		{"imperial", 5000, "3.1 mi"},
+		{"imperial", 1609.344, "1.0 mi"},
+		{"imperial", 42195, "26.2 mi"},
+		{"imperial", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %v", tt.units, tt.meters), func(t *testing.T) {
+			withSettings(t, map[string]string{"UNITS": tt.units})
+			if got := formatDistance(tt.meters); got != tt.want {
+				t.Errorf("formatDistance(%v) = %q, want %q", tt.meters, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchClubEventsOverlappingPages(t *testing.T) {
+	withSettings(t, nil)
+
+	// A full first page, then a second page repeating its last event
+	pages := map[string][]StravaEvent{"1": {}, "2": {{ID: 200}, {ID: 201}}}
+	for id := int64(1); id <= 200; id++ {
+		pages["1"] = append(pages["1"], StravaEvent{ID: id})
+	}
+	withStravaServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/clubs/123/group_events" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(pages[r.URL.Query().Get("page")])
+	})
+
+	events, err := fetchClubEvents(context.Background(), testTokens(), "123", true)
+	if err != nil {
+		t.Fatalf("fetchClubEvents: %v", err)
+	}
+	count := make(map[int64]int)
+	for _, event := range events {
+		count[event.ID]++
+	}
+	if count[200] != 1 {
+		t.Errorf("event 200 appears %d times, want once", count[200])
+	}
+	if len(events) != 201 {
+		t.Errorf("got %d events, want 201", len(events))
+	}
+}
+
+func TestParseOccurrence(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2025, 10, 18, 7, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+	}{
+		{"Z", "2025-10-18T07:00:00Z", want},
+		{"Z with fractional seconds", "2025-10-18T07:00:00.000Z", want},
+		{"numeric offset", "2025-10-18T08:00:00+01:00", want},
+		{"negative offset with fractional seconds", "2025-10-18T03:00:00.5-04:00", want.Add(500 * time.Millisecond)},
+		{"zoneless, in the event's zone", "2025-10-18T08:00:00", want},
+		{"zoneless with fractional seconds", "2025-10-18T08:00:00.250", want.Add(250 * time.Millisecond)},
+		{"zoneless with a space", "2025-10-18 08:00:00", want},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOccurrence(tt.value, london)
+			if err != nil {
+				t.Fatalf("parseOccurrence(%q): %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) || got.Location() != time.UTC {
+				t.Errorf("parseOccurrence(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "18/10/2025 08:00", "2025-10-18"} {
+		if _, err := parseOccurrence(value, london); err == nil {
+			t.Errorf("parseOccurrence(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestRedactPhoneNumbers(t *testing.T) {
+	const redacted = "[Phone Number Redacted]"
+	tests := []struct {
+		name    string
+		regions string
+		text    string
+		want    string
+	}{
+		{"UK mobile", "", "Call 07801 252100", "Call " + redacted},
+		{"UK mobile with country code", "UK", "Call +44 (0)7801-252-100", "Call " + redacted},
+		{"UK landline", "UK", "Call (020) 7946 0018", "Call " + redacted},
+		{"US with brackets", "US", "Call (555) 123-4567", "Call " + redacted},
+		{"US with country code", "US", "Call +1 555-123-4567", "Call " + redacted},
+		{"French", "INTL", "Appelez +33 6 12 34 56 78", "Appelez " + redacted},
+		{"German", "INTL", "Ruf an: +49 30 12345678", "Ruf an: " + redacted},
+		{"every region", "UK,US,INTL", "07801 252100, (555) 123-4567 or +49 30 12345678",
+			redacted + ", " + redacted + " or " + redacted},
+		{"distance", "UK,US,INTL", "A 5000 m loop", "A 5000 m loop"},
+		{"short international number", "INTL", "Gate +33 12", "Gate +33 12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSettings(t, map[string]string{"PHONE_REGION": tt.regions})
+			if got := redactPhoneNumbers(tt.text); got != tt.want {
+				t.Errorf("redactPhoneNumbers(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactPhoneNumbersKeepsNonPhoneNumbers(t *testing.T) {
+	withSettings(t, map[string]string{"PHONE_REGION": "UK,US,INTL"})
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"order number", "Kit order 0123456789 has arrived"},
+		{"order number after no", "Order no. 0123456789 has arrived"},
+		{"reference", "Booking ref 07801252100"},
+		{"hash", "See ticket #0123456789"},
+		{"URL", "Route at https://example.com/routes/0123456789"},
+		{"price", "Entry is £0123456789"},
+		{"distance", "Elevation 0123456789 ft"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactPhoneNumbers(tt.text); got != tt.text {
+				t.Errorf("redactPhoneNumbers(%q) = %q, want it unchanged", tt.text, got)
+			}
+		})
+	}
+
+	// A phone number next to an order number is still redacted
+	text := "Order 0123456789, questions to 07801 252100"
+	want := "Order 0123456789, questions to [Phone Number Redacted]"
+	if got := redactPhoneNumbers(text); got != want {
+		t.Errorf("redactPhoneNumbers(%q) = %q, want %q", text, got, want)
+	}
+}
+
+func TestConvertStravaEventMixedOccurrences(t *testing.T) {
+	withSettings(t, nil)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	past := now.AddDate(0, 0, -7)
+	next := now.AddDate(0, 0, 7)
+	later := now.AddDate(0, 0, 14)
+	se := StravaEvent{ID: 1, Title: "Tuesday Tempo", UpcomingOccurrences: []string{
+		past.Format(time.RFC3339), later.Format(time.RFC3339), next.Format(time.RFC3339),
+	}}
+
+	events, err := convertStravaEvent(se, "123")
+	if err != nil {
+		t.Fatalf("convertStravaEvent: %v", err)
+	}
+	// Every occurrence is kept, in start order
+	var starts []time.Time
+	for _, event := range events {
+		starts = append(starts, event.Start)
+	}
+	if want := []time.Time{past, next, later}; !slices.EqualFunc(starts, want, time.Time.Equal) {
+		t.Errorf("occurrence starts = %v, want %v", starts, want)
+	}
+
+	if got := nextOccurrence(events, now); !got.Equal(next) {
+		t.Errorf("nextOccurrence = %v, want the first future one %v", got, next)
+	}
+	// With every occurrence started, the latest is the next one
+	if got := nextOccurrence(events, later.Add(time.Hour)); !got.Equal(later) {
+		t.Errorf("nextOccurrence after all started = %v, want the latest %v", got, later)
+	}
+}
+
+// withOrganizer returns se organized by an athlete with the given names
+func withOrganizer(se StravaEvent, firstName, lastName string) StravaEvent {
+	se.OrganizingAthlete.FirstName = firstName
+	se.OrganizingAthlete.LastName = lastName
+	return se
+}
+
+func TestConvertStravaEvent(t *testing.T) {
+	withSettings(t, nil)
+
+	start := time.Date(2030, 7, 2, 17, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		se      StravaEvent
+		wantErr bool
+		check   func(t *testing.T, event Event)
+	}{
+		{
+			name:    "no occurrences",
+			se:      StravaEvent{ID: 42, Title: "Tuesday Tempo"},
+			wantErr: true,
+		},
+		{
+			name:    "no valid occurrences",
+			se:      StravaEvent{ID: 42, Title: "Tuesday Tempo", UpcomingOccurrences: []string{"next Tuesday"}},
+			wantErr: true,
+		},
+		{
+			name: "single occurrence",
+			se:   StravaEvent{ID: 42, Title: "Tuesday &amp; Tempo", ActivityType: "Run", Zone: "Europe/London", UpcomingOccurrences: []string{"2030-07-02T17:30:00Z"}},
+			check: func(t *testing.T, event Event) {
+				if event.ID != 42 || event.Title != "Tuesday & Tempo" || !event.Start.Equal(start) || event.ClubID != "123" || event.Zone != "Europe/London" {
+					t.Errorf("event = %+v", event)
+				}
+			},
+		},
+		{
+			name: "organizer trimmed",
+			se:   withOrganizer(StravaEvent{ID: 42, UpcomingOccurrences: []string{"2030-07-02T17:30:00Z"}}, "  Jane ", " "),
+			check: func(t *testing.T, event Event) {
+				if event.Organizer != "Jane" {
+					t.Errorf("organizer = %q, want %q", event.Organizer, "Jane")
+				}
+			},
+		},
+		{
+			name: "phone number redacted",
+			se:   StravaEvent{ID: 42, Description: "Late? Call 07801 252100", UpcomingOccurrences: []string{"2030-07-02T17:30:00Z"}},
+			check: func(t *testing.T, event Event) {
+				if want := "Late? Call [Phone Number Redacted]"; event.Description != want {
+					t.Errorf("description = %q, want %q", event.Description, want)
+				}
+			},
+		},
+		{
+			name: "URL",
+			se:   StravaEvent{ID: 42, UpcomingOccurrences: []string{"2030-07-02T17:30:00Z"}},
+			check: func(t *testing.T, event Event) {
+				if want := "https://www.strava.com/clubs/123/group_events/42"; event.URL != want {
+					t.Errorf("URL = %q, want %q", event.URL, want)
+				}
+			},
+		},
+		{
+			name: "one hour end estimate",
+			se:   StravaEvent{ID: 42, ActivityType: "Run", UpcomingOccurrences: []string{"2030-07-02T17:30:00Z"}},
+			check: func(t *testing.T, event Event) {
+				if want := start.Add(time.Hour); !event.End.Equal(want) {
+					t.Errorf("end = %v, want %v", event.End, want)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := convertStravaEvent(tt.se, "123")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("convertStravaEvent = %+v, want an error", events)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convertStravaEvent: %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			tt.check(t, events[0])
+		})
+	}
+}
+
+// loadSampleEvents returns the sample events in output/validation/events_raw.json,
+// skipping the test when there are none
+func loadSampleEvents(t *testing.T) []StravaEvent {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", defaultOutputDir, validationFile))
+	if errors.Is(err, os.ErrNotExist) {
+		t.Skip("no sample events in " + validationFile)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []StravaEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		t.Fatalf("failed to parse sample events: %v", err)
+	}
+	return events
+}
+
+func TestConvertSampleEvents(t *testing.T) {
+	withSettings(t, nil)
+
+	for _, se := range loadSampleEvents(t) {
+		// Events without occurrences fail to convert rather than panicking
+		events, err := convertStravaEvent(se, "123")
+		if err != nil {
+			t.Logf("event %d: %v", se.ID, err)
+			continue
+		}
+		for _, event := range events {
+			if event.ID != se.ID || event.Start.IsZero() || event.End.Before(event.Start) {
+				t.Errorf("event %d converted to %+v", se.ID, event)
+			}
+		}
+	}
+}
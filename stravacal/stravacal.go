@@ -0,0 +1,196 @@
+// Package stravacal fetches upcoming club events from Strava and publishes them
+// as an ICS file, an HTML schedule, and Google Calendar or CalDAV events
+//
+// CRITICAL: Uses partner API endpoint not in official documentation:
+// GET /clubs/{id}/group_events?upcoming=true
+//
+// Every setting comes from a Config, keyed by the variable names documented in
+// the README; nothing is read from the environment. The strava-events command
+// fills the Config from the environment, a config file and flags
+package stravacal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Config holds the settings for the library. The fields set the settings used
+// by most programs; Settings holds the rest by variable name, e.g.
+// "DEFAULT_TIMEZONE" or "ICS_CALENDAR_NAME". A field that is set takes
+// precedence over the same variable in Settings, and unset variables take
+// their defaults
+type Config struct {
+	ClubIDs            []string // STRAVA_CLUB_ID, the first being the primary club
+	StravaClientID     string   // STRAVA_CLIENT_ID
+	StravaClientSecret string   // CLIENT_SECRET
+	StravaRefreshToken string   // REFRESH_TOKEN
+	CalendarID         string   // GOOGLE_CALENDAR_ID
+	WindowDays         int      // SYNC_WINDOW_DAYS
+
+	Settings map[string]string
+
+	// FromFile marks the settings read from a config file, for "config check"
+	FromFile map[string]bool
+
+	// settings are the values parsed by validation
+	settings *settings
+}
+
+// value returns a setting by variable name, or "" when it isn't set
+func (c *Config) value(name string) string {
+	switch name {
+	case "STRAVA_CLUB_ID":
+		if len(c.ClubIDs) > 0 {
+			return strings.Join(c.ClubIDs, ",")
+		}
+	case "STRAVA_CLIENT_ID":
+		if c.StravaClientID != "" {
+			return c.StravaClientID
+		}
+	case "CLIENT_SECRET":
+		if c.StravaClientSecret != "" {
+			return c.StravaClientSecret
+		}
+	case "REFRESH_TOKEN":
+		if c.StravaRefreshToken != "" {
+			return c.StravaRefreshToken
+		}
+	case "GOOGLE_CALENDAR_ID":
+		if c.CalendarID != "" {
+			return c.CalendarID
+		}
+	case "SYNC_WINDOW_DAYS":
+		if c.WindowDays != 0 {
+			return strconv.Itoa(c.WindowDays)
+		}
+	}
+	return c.Settings[name]
+}
+
+// Validate checks every setting, and that the variables the given command of
+// the strava-events command needs are set ("" is the full sync)
+// Like every exported function that takes a Config, it waits for any other
+// such call to finish, since the package reads its settings from the one in use
+func (c Config) Validate(command string) error {
+	defer use(c)()
+	return validateConfig(command)
+}
+
+var (
+	// config is the Config in use, read by getenv
+	config atomic.Pointer[Config]
+
+	// configMu lets one exported call use its Config at a time
+	configMu sync.Mutex
+)
+
+// use makes cfg the Config in use until the returned function is called
+// Exported functions call it first, so calls with different Configs don't mix
+func use(cfg Config) func() {
+	configMu.Lock()
+	previous := config.Swap(&cfg)
+	return func() {
+		config.Store(previous)
+		configMu.Unlock()
+	}
+}
+
+// suspend stops using the Config in use, letting other calls use theirs,
+// until the returned function is called. It's for long waits like the serve
+// command's, which uses its Config again for each sync
+func suspend() func() {
+	cfg := config.Swap(nil)
+	configMu.Unlock()
+	return func() {
+		configMu.Lock()
+		config.Store(cfg)
+	}
+}
+
+// current returns the Config in use, or an empty one
+func current() *Config {
+	if cfg := config.Load(); cfg != nil {
+		return cfg
+	}
+	return &Config{}
+}
+
+// getenv returns a setting of the Config in use by variable name, or "" when
+// it isn't set
+func getenv(name string) string {
+	return current().value(name)
+}
+
+// Variables returns the name of every configuration variable, as documented
+// in the README
+func Variables() []string {
+	names := make([]string, len(configVariables))
+	for i, variable := range configVariables {
+		names[i] = variable.name
+	}
+	return names
+}
+
+// FetchClubEvents fetches the upcoming events of a Strava club, authenticating
+// with the Strava credentials in cfg. It waits for other calls with a Config
+// to finish, and holds off new ones until it returns
+func FetchClubEvents(ctx context.Context, cfg Config, clubID string) ([]StravaEvent, error) {
+	defer use(cfg)()
+	if err := validateSettings("STRAVA_CLIENT_ID", "CLIENT_SECRET", "REFRESH_TOKEN"); err != nil {
+		return nil, err
+	}
+
+	tokens, err := loadTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokens: %w", err)
+	}
+	return fetchClubEvents(ctx, tokens, clubID, true)
+}
+
+// ConvertStravaEvent converts a Strava event of the given club into one Event
+// for each upcoming occurrence, using the timezone, duration and redaction
+// settings in cfg. Calls with a Config run one at a time
+func ConvertStravaEvent(cfg Config, se StravaEvent, clubID string) ([]Event, error) {
+	defer use(cfg)()
+	if err := validateSettings(); err != nil {
+		return nil, err
+	}
+	return convertStravaEvent(se, clubID)
+}
+
+// GenerateICS returns an iCalendar file of events, with the calendar name and
+// ICS settings in cfg. clubID is the club linked from event descriptions
+// Calls with a Config run one at a time
+func GenerateICS(cfg Config, events []Event, clubID string) (string, error) {
+	defer use(cfg)()
+	if err := validateSettings(); err != nil {
+		return "", err
+	}
+	return generateICS(events, clubID), nil
+}
+
+// SyncEvents creates, updates and deletes events in the Google Calendar
+// cfg.CalendarID so it matches events, leaving events it didn't create alone.
+// With dryRun the changes are only logged. The report is set whenever the
+// calendar was diffed, even if some changes failed. Calls with a Config run
+// one at a time, so this holds off the others until the sync is done
+func SyncEvents(ctx context.Context, cfg Config, events []Event, dryRun bool) (*SyncReport, error) {
+	defer use(cfg)()
+	if err := validateSettings("STRAVA_CLUB_ID", "GOOGLE_CALENDAR_ID"); err != nil {
+		return nil, err
+	}
+	calendarID := getenv("GOOGLE_CALENDAR_ID")
+
+	srv, err := getCalendarService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with Google Calendar: %w", err)
+	}
+	if err := checkCalendarAccess(ctx, srv, calendarID); err != nil {
+		return nil, err
+	}
+	return syncStravaEvents(ctx, events, srv, calendarID, validated().clubID, validated().windowDays, dryRun)
+}
@@ -0,0 +1,34 @@
+package stravacal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSuspendLetsOtherConfigsRun(t *testing.T) {
+	withSettings(t, map[string]string{"HTTP_TIMEOUT": "5s"})
+
+	resume := suspend()
+	done := make(chan time.Duration)
+	go func() {
+		defer use(Config{Settings: map[string]string{"HTTP_TIMEOUT": "7s"}})()
+		if err := validateSettings(); err != nil {
+			t.Errorf("validateSettings: %v", err)
+		}
+		done <- httpClient().Timeout
+	}()
+
+	select {
+	case timeout := <-done:
+		if timeout != 7*time.Second {
+			t.Errorf("other call's HTTP timeout = %v, want 7s", timeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("other call is still waiting for the suspended Config")
+	}
+
+	resume()
+	if timeout := httpClient().Timeout; timeout != 5*time.Second {
+		t.Errorf("HTTP timeout after resuming = %v, want 5s", timeout)
+	}
+}
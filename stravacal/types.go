@@ -0,0 +1,129 @@
+package stravacal
+
+import "time"
+
+// TokenStore holds the OAuth credentials for Strava API authentication
+type TokenStore struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"` // Unix timestamp when AccessToken expires
+}
+
+// CachedToken is the access token persisted between runs so a still-valid
+// token can be reused instead of refreshing on every invocation
+type CachedToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+// Event represents a standardized club event with all necessary information
+// This is the main data structure used throughout the application
+type Event struct {
+	ID           int64      `json:"id"`
+	Title        string     `json:"title"`
+	Start        time.Time  `json:"start"`
+	End          time.Time  `json:"end"`
+	Description  string     `json:"description"`
+	URL          string     `json:"url"`
+	Location     string     `json:"location"`
+	Organizer    string     `json:"organizer"`
+	ActivityType string     `json:"activity_type,omitempty"` // e.g. "Run"
+	SkillLevels  *int       `json:"skill_levels,omitempty"`  // Bitmask: 1=Beginner, 2=Intermediate, 4=Advanced
+	Terrain      *int       `json:"terrain,omitempty"`       // 0=Road, 1=Trail, 2=Mixed
+	Zone         string     `json:"zone,omitempty"`          // IANA timezone, e.g. "Europe/London"
+	StartLatLng  []float64  `json:"start_latlng,omitempty"`  // [lat, lng] of the meeting point
+	Distance     float64    `json:"distance,omitempty"`      // Route distance in meters, 0 without a route
+	MovingTime   int        `json:"moving_time,omitempty"`   // Estimated moving time in seconds, 0 if unknown
+	PhotoURL     string     `json:"photo_url,omitempty"`     // Cover photo, empty when the event has none
+	Attending    *int       `json:"attending,omitempty"`     // Athletes who joined, nil when Strava didn't say
+	ClubID       string     `json:"club_id,omitempty"`       // Strava club the event was fetched from
+	WomenOnly    bool       `json:"women_only,omitempty"`
+	Private      bool       `json:"private,omitempty"`
+	MissingSince *time.Time `json:"missing_since,omitempty"` // First run the event was missing from the Strava fetch
+	MissingRuns  int        `json:"missing_runs,omitempty"`  // Consecutive runs the event has been missing
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`  // Set when the event disappeared from Strava before it started
+
+	// Copies of the event posted to other clubs, merged into it with MERGE_CLUB_DUPLICATES
+	Duplicates []DuplicateEvent `json:"duplicates,omitempty"`
+}
+
+// DuplicateEvent is a copy of an event posted to another club
+type DuplicateEvent struct {
+	ID     int64  `json:"id"`
+	ClubID string `json:"club_id"`
+	URL    string `json:"url"`
+}
+
+// StravaEvent represents the actual structure returned by the Strava API
+// This was reverse-engineered from real API responses in October 2025
+// Key differences from expected:
+// - No start_date_local, uses upcoming_occurrences array instead
+// - No end_date_local, must be calculated
+// - Rich nested objects for organizer, route, etc.
+type StravaEvent struct {
+	ID                int64  `json:"id"`
+	Title             string `json:"title"`
+	Description       string `json:"description"`
+	ClubID            int64  `json:"club_id"`
+	OrganizingAthlete struct {
+		ID        int64  `json:"id"`
+		FirstName string `json:"firstname"`
+		LastName  string `json:"lastname"`
+	} `json:"organizing_athlete"`
+	ActivityType        string       `json:"activity_type"` // e.g., "Run"
+	RouteID             *int64       `json:"route_id"`      // May be null
+	Route               *StravaRoute `json:"route"`         // Null when no route is attached
+	WomenOnly           bool         `json:"women_only"`
+	Private             bool         `json:"private"`              // Always true for club events
+	SkillLevels         *int         `json:"skill_levels"`         // Bitmask: 1=Beginner, 2=Intermediate, 4=Advanced
+	Terrain             *int         `json:"terrain"`              // 0=Road, 1=Trail, 2=Mixed
+	UpcomingOccurrences []string     `json:"upcoming_occurrences"` // ISO8601 timestamps
+	Zone                string       `json:"zone"`                 // e.g., "Europe/London"
+	Address             string       `json:"address"`              // Location description or coordinates
+	Joined              bool         `json:"joined"`               // If current user joined
+	StartLatLng         []float64    `json:"start_latlng"`         // [lat, lng] coordinates
+	PhotoURL            string       `json:"photo_url"`            // Cover photo, missing for most events
+	AthleteCount        *int         `json:"athlete_count"`        // Athletes who joined, missing from some responses
+}
+
+// StravaRoute is the route attached to a club event
+type StravaRoute struct {
+	ID                  int64   `json:"id"`
+	Name                string  `json:"name"`
+	Distance            float64 `json:"distance"`              // Meters
+	ElevationGain       float64 `json:"elevation_gain"`        // Meters
+	EstimatedMovingTime int     `json:"estimated_moving_time"` // Seconds, Strava's estimate for the route
+}
+
+// TokenResponse represents the response from Strava OAuth token endpoint
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// SyncReport summarizes what a Google Calendar sync did, for monitoring
+type SyncReport struct {
+	RunAt      time.Time          `json:"run_at"`
+	CalendarID string             `json:"calendar_id"`
+	DryRun     bool               `json:"dry_run,omitempty"`
+	Fetched    int                `json:"fetched"` // Occurrences fetched from Strava, 0 when syncing from the cache
+	Created    int                `json:"created"`
+	Updated    int                `json:"updated"`
+	Deleted    int                `json:"deleted"`
+	Skipped    int                `json:"skipped"` // Already up to date
+	Failed     int                `json:"failed"`
+	Events     []SyncEventOutcome `json:"events"`
+}
+
+// SyncEventOutcome records the change made to a single calendar event
+type SyncEventOutcome struct {
+	UID     string   `json:"uid"`
+	EventID int64    `json:"event_id,omitempty"`
+	Title   string   `json:"title"`
+	Action  string   `json:"action"`            // "create", "update", "adopt", "delete" or "skip"
+	Changes []string `json:"changes,omitempty"` // Fields that differed for an update, e.g. "time"
+	Error   string   `json:"error,omitempty"`
+}